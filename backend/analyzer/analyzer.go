@@ -0,0 +1,409 @@
+// Package analyzer fetches a web page and reports what it finds: the HTML
+// version, title and headings, the links and whether they work, the
+// resources the page loads, indexability, the search snippet, keywords and
+// markup problems. Nothing is stored; the backend persists the Result.
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	// ErrTargetBlocked is returned for pages, redirects and connections
+	// Options.TargetAllowed or Options.AddressAllowed reject.
+	ErrTargetBlocked = errors.New("target is blocked by the target rules")
+
+	// ErrNotModified is returned by Analyze when a conditional request
+	// finds the page unchanged since the last run.
+	ErrNotModified = errors.New("page not modified")
+)
+
+// Result is what Analyze found on a page. Checks that did not run leave
+// their fields empty.
+type Result struct {
+	URL                 string            `json:"url"`
+	Options             Options           `json:"options"`
+	HTMLVersion         string            `json:"html_version"`
+	Title               string            `json:"title"`
+	H1Count             int               `json:"h1_count"`
+	H2Count             int               `json:"h2_count"`
+	H3Count             int               `json:"h3_count"`
+	H4Count             int               `json:"h4_count"`
+	H5Count             int               `json:"h5_count"`
+	H6Count             int               `json:"h6_count"`
+	InternalLinks       int               `json:"internal_links"`
+	ExternalLinks       int               `json:"external_links"`
+	InaccessibleLinks   *int              `json:"inaccessible_links"`
+	BrokenLinks         []string          `json:"broken_links"`
+	LinkChecks          []LinkCheck       `json:"-"`
+	DependencyChecks    []LinkCheck       `json:"-"`
+	SlowestDependencies []LinkCheck       `json:"slowest_dependencies"`
+	LargestDependencies []LinkCheck       `json:"largest_dependencies"`
+	Links               []string          `json:"-"`
+	AnchorTexts         map[string]string `json:"-"`
+	LinksSkipped        int               `json:"links_skipped,omitempty"`
+	HasLoginForm        bool              `json:"has_login_form"`
+	MetaRobots          string            `json:"meta_robots"`
+	XRobotsTag          string            `json:"x_robots_tag"`
+	NoIndex             bool              `json:"noindex"`
+	NoFollow            bool              `json:"nofollow"`
+	Indexable           *bool             `json:"indexable"`
+	IndexabilityWarning string            `json:"indexability_warning"`
+	SEO                 SEOReport         `json:"seo"`
+	ValidationErrors    int               `json:"validation_error_count"`
+	ValidationFindings  []string          `json:"validation_findings"`
+	Language            string            `json:"language"`
+	WordCount           int               `json:"word_count"`
+	Keywords            []Keyword         `json:"-"`
+	Bigrams             []Keyword         `json:"-"`
+	Outline             []Heading         `json:"-"`
+	SkippedChecks       CheckList         `json:"skipped_checks"`
+	ETag                string            `json:"etag"`
+	LastModified        string            `json:"last_modified"`
+	Redirects           RedirectChain     `json:"redirects"`
+}
+
+// maxPageBytes caps how much of the analyzed page is read, so a huge or
+// endless response cannot exhaust memory. A longer page is analyzed up to
+// the limit.
+const maxPageBytes = 10 << 20
+
+// Analyze fetches and analyzes a page. progress, if not nil, is called as
+// the page's links are checked. Checks left out of opts.Checks are listed
+// in SkippedChecks and leave their fields empty, or null where empty would
+// read as a result.
+func Analyze(ctx context.Context, urlStr string, opts Options, progress func(done, total int)) (*Result, error) {
+	log.Printf("Analyzing URL: %s", urlStr)
+	if err := opts.scopeToPage(urlStr); err != nil {
+		return nil, err
+	}
+	defer opts.closeIdleConnections()
+
+	redirects := RedirectChain{}
+	client := &http.Client{
+		Transport:     opts.httpTransport(),
+		Timeout:       opts.PageTimeout(),
+		CheckRedirect: opts.checkRedirect(ErrTargetBlocked, (*[]RedirectHop)(&redirects)),
+	}
+	if opts.Capture != nil {
+		client.Transport = opts.Capture.transport(client.Transport)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.targetAllowed(req.URL) {
+		return nil, ErrTargetBlocked
+	}
+	opts.prepareRequest(req)
+	if opts.IfNoneMatch != "" {
+		req.Header.Set("If-None-Match", opts.IfNoneMatch)
+	}
+	if opts.IfModifiedSince != "" {
+		req.Header.Set("If-Modified-Since", opts.IfModifiedSince)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	analysis := &Result{
+		URL:           urlStr,
+		Options:       opts,
+		SkippedChecks: opts.skippedChecks(),
+		ETag:          resp.Header.Get("ETag"),
+		LastModified:  resp.Header.Get("Last-Modified"),
+		Redirects:     redirects,
+	}
+
+	var metaRobots []string
+	var description string
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if n.FirstChild != nil {
+					analysis.Title = n.FirstChild.Data
+				}
+			case "meta":
+				var name, content string
+				for _, attr := range n.Attr {
+					switch attr.Key {
+					case "name":
+						name = strings.ToLower(attr.Val)
+					case "content":
+						content = attr.Val
+					}
+				}
+				if name == "robots" || name == "googlebot" {
+					metaRobots = append(metaRobots, content)
+				}
+				if name == "description" && description == "" {
+					description = content
+				}
+			case "h1":
+				analysis.H1Count++
+			case "h2":
+				analysis.H2Count++
+			case "h3":
+				analysis.H3Count++
+			case "h4":
+				analysis.H4Count++
+			case "h5":
+				analysis.H5Count++
+			case "h6":
+				analysis.H6Count++
+			case "a":
+				for _, attr := range n.Attr {
+					if attr.Key == "href" {
+						if strings.HasPrefix(attr.Val, "http") {
+							analysis.ExternalLinks++
+						} else {
+							analysis.InternalLinks++
+						}
+					}
+				}
+			case "form":
+				for _, attr := range n.Attr {
+					if attr.Key == "action" && (strings.Contains(attr.Val, "login") || strings.Contains(attr.Val, "signin")) {
+						analysis.HasLoginForm = true
+						break
+					}
+				}
+				// Also check for password input fields
+				if !analysis.HasLoginForm {
+					var checkForPassword func(*html.Node)
+					checkForPassword = func(child *html.Node) {
+						if child.Type == html.ElementNode && child.Data == "input" {
+							for _, attr := range child.Attr {
+								if attr.Key == "type" && attr.Val == "password" {
+									analysis.HasLoginForm = true
+									return
+								}
+							}
+						}
+						for c := child.FirstChild; c != nil; c = c.NextSibling {
+							checkForPassword(c)
+						}
+					}
+					checkForPassword(n)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	analysis.HTMLVersion = getHTMLVersion(doc)
+	analysis.Outline = extractOutline(doc)
+	if opts.checkEnabled("validation") {
+		analysis.ValidationErrors, analysis.ValidationFindings = validateHTML(body)
+	}
+	if opts.checkEnabled("keywords") {
+		analysis.Language, analysis.WordCount, analysis.Keywords, analysis.Bigrams = extractKeywords(doc)
+	}
+	if opts.checkEnabled("seo") {
+		analysis.SEO = checkSnippet(analysis.Title, description)
+	}
+	if opts.checkEnabled("indexability") {
+		applyIndexability(analysis, metaRobots, resp.Header.Values("X-Robots-Tag"))
+	}
+
+	analysis.Links, analysis.AnchorTexts = collectLinks(doc, analysis.URL)
+	if opts.checkEnabled("links") {
+		analysis.LinkChecks = checkLinks(ctx, analysis.URL, analysis.Links, opts, progress)
+		analysis.BrokenLinks = FailedLinks(analysis.LinkChecks)
+		inaccessible := len(analysis.BrokenLinks)
+		analysis.InaccessibleLinks = &inaccessible
+		analysis.DependencyChecks = checkDependencies(ctx, analysis.URL, collectDependencies(doc, analysis.URL), opts)
+	}
+	analysis.LinksSkipped = len(analysis.Links) - len(analysis.LinkChecks)
+	analysis.SlowestDependencies, analysis.LargestDependencies = rankDependencies(analysis.DependencyChecks)
+
+	return analysis, nil
+}
+
+// collectLinks returns the href of every anchor in the document resolved
+// against baseURL, in document order, and the text of the first anchor of
+// each link.
+func collectLinks(doc *html.Node, baseURL string) ([]string, map[string]string) {
+	var links []string
+	anchorTexts := map[string]string{}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return links, anchorTexts
+	}
+
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			for _, attr := range n.Attr {
+				if attr.Key == "href" {
+					link, err := url.Parse(attr.Val)
+					if err != nil {
+						continue
+					}
+
+					resolved := base.ResolveReference(link).String()
+					links = append(links, resolved)
+					if _, ok := anchorTexts[resolved]; !ok {
+						anchorTexts[resolved] = elementText(n)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return links, anchorTexts
+}
+
+// elementText returns the text of an element such as an anchor or heading
+// with collapsed whitespace, falling back to its label or the alt text of
+// its images.
+func elementText(a *html.Node) string {
+	var text, alt []string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			text = append(text, n.Data)
+		}
+		if n.Type == html.ElementNode && n.Data == "img" {
+			for _, attr := range n.Attr {
+				if attr.Key == "alt" {
+					alt = append(alt, attr.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(a)
+
+	result := strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+	if result == "" {
+		for _, attr := range a.Attr {
+			if attr.Key == "aria-label" || attr.Key == "title" {
+				result = strings.TrimSpace(attr.Val)
+				break
+			}
+		}
+	}
+	if result == "" {
+		result = strings.Join(strings.Fields(strings.Join(alt, " ")), " ")
+	}
+	if runes := []rune(result); len(runes) > 255 {
+		result = string(runes[:255])
+	}
+	return result
+}
+
+// CheckLinks requests links found on pageURL outside of a full analysis,
+// such as the links stored by an earlier run. It behaves like the link
+// check of Analyze.
+func CheckLinks(ctx context.Context, pageURL string, links []string, opts Options, progress func(done, total int)) ([]LinkCheck, error) {
+	if err := opts.scopeToPage(pageURL); err != nil {
+		return nil, err
+	}
+	defer opts.closeIdleConnections()
+	return checkLinks(ctx, pageURL, links, opts, progress), nil
+}
+
+// checkLinks requests the links found on pageURL and returns the outcome
+// of each checked link. At most opts.MaxLinks links are checked when it is
+// set and links matching the exclude patterns are skipped. progress, if not
+// nil, is called after each link. Checking stops early when ctx is
+// cancelled.
+func checkLinks(ctx context.Context, pageURL string, links []string, opts Options, progress func(done, total int)) []LinkCheck {
+	var checks []LinkCheck
+
+	total := len(links)
+	if opts.MaxLinks > 0 && opts.MaxLinks < total {
+		total = opts.MaxLinks
+	}
+
+	excluded := opts.excludeMatcher()
+	for i, link := range links[:total] {
+		if ctx.Err() != nil {
+			break
+		}
+		if excluded(link) || !opts.linkAllowed(link) {
+			continue
+		}
+		if i > 0 && opts.RequestDelayMS > 0 {
+			time.Sleep(opts.requestDelay())
+		}
+
+		checks = append(checks, checkLink(ctx, link, opts))
+		if progress != nil {
+			progress(len(checks), total)
+		}
+	}
+
+	markExternal(checks, pageURL)
+	return checks
+}
+
+func getHTMLVersion(doc *html.Node) string {
+	var version string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.DoctypeNode {
+			version = n.Data
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	if strings.Contains(strings.ToLower(version), "html 5") || version == "html" {
+		return "HTML5"
+	} else if strings.Contains(strings.ToLower(version), "xhtml 1.1") {
+		return "XHTML 1.1"
+	} else if strings.Contains(strings.ToLower(version), "xhtml 1.0") {
+		return "XHTML 1.0"
+	} else if strings.Contains(strings.ToLower(version), "html 4.01") {
+		return "HTML 4.01"
+	} else if strings.Contains(strings.ToLower(version), "html 4.0") {
+		return "HTML 4.0"
+	} else {
+		return "HTML5" // Default to HTML5 if no doctype found
+	}
+}
@@ -0,0 +1,11 @@
+package analyzer_test
+
+import (
+	"testing"
+
+	"challenge-sykell/backend/analyzertest"
+)
+
+func TestAnalyze(t *testing.T) {
+	analyzertest.Run(t)
+}
@@ -0,0 +1,100 @@
+package analyzer
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// Options.Capture records the page requests of a run so a failed run can be
+// inspected. Credential headers are redacted.
+
+// debugBodyLimit is how much of each response body is kept.
+const debugBodyLimit = 64 << 10
+
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// Exchange is a request and the response or error it got.
+type Exchange struct {
+	Request         string      `json:"request"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	Status          string      `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	Body            string      `json:"body,omitempty"`
+	BodyTruncated   bool        `json:"body_truncated,omitempty"`
+	Error           string      `json:"error,omitempty"`
+
+	body bytes.Buffer
+}
+
+// Capture records the exchanges of an http.Client.
+type Capture struct {
+	Exchanges []*Exchange `json:"exchanges"`
+}
+
+// transport wraps base so every exchange is recorded.
+func (d *Capture) transport(base http.RoundTripper) http.RoundTripper {
+	return captureTransport{base: base, capture: d}
+}
+
+// Finish copies the captured bodies into the exchanges.
+func (d *Capture) Finish() {
+	for _, ex := range d.Exchanges {
+		ex.Body = ex.body.String()
+	}
+}
+
+type captureTransport struct {
+	base    http.RoundTripper
+	capture *Capture
+}
+
+func (t captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proto := req.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	ex := &Exchange{
+		Request:        req.Method + " " + req.URL.String() + " " + proto,
+		RequestHeaders: redactHeaders(req.Header),
+	}
+	t.capture.Exchanges = append(t.capture.Exchanges, ex)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		ex.Error = err.Error()
+		return nil, err
+	}
+
+	ex.Status = resp.Proto + " " + resp.Status
+	ex.ResponseHeaders = redactHeaders(resp.Header)
+	resp.Body = &captureBody{ReadCloser: resp.Body, exchange: ex}
+	return resp, nil
+}
+
+// captureBody keeps the first debugBodyLimit bytes read from a body.
+type captureBody struct {
+	io.ReadCloser
+	exchange *Exchange
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := debugBodyLimit - b.exchange.body.Len(); room > 0 {
+		b.exchange.body.Write(p[:min(n, room)])
+		b.exchange.BodyTruncated = n > room
+	} else if n > 0 {
+		b.exchange.BodyTruncated = true
+	}
+	return n, err
+}
+
+func redactHeaders(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "[redacted]")
+		}
+	}
+	return redacted
+}
@@ -0,0 +1,94 @@
+package analyzer
+
+import "strings"
+
+// robotsDirectives holds the indexing signals found in a robots meta tag or
+// an X-Robots-Tag header.
+type robotsDirectives struct {
+	NoIndex  bool
+	NoFollow bool
+}
+
+// robotsValueDirectives take a value after a colon, which must not be
+// mistaken for a crawler scope.
+var robotsValueDirectives = map[string]bool{
+	"max-snippet":       true,
+	"max-image-preview": true,
+	"max-video-preview": true,
+	"unavailable_after": true,
+}
+
+// parseRobotsDirectives reads a comma separated directive list such as
+// "noindex, nofollow". X-Robots-Tag values may be scoped to a crawler
+// ("otherbot: noindex, nofollow"); a scope holds until the next one and only
+// generic and googlebot scoped directives are counted.
+func parseRobotsDirectives(value string) robotsDirectives {
+	var d robotsDirectives
+	counted := true
+	for _, part := range strings.Split(value, ",") {
+		token := strings.ToLower(strings.TrimSpace(part))
+		if agent, rest, ok := strings.Cut(token, ":"); ok && !robotsValueDirectives[strings.TrimSpace(agent)] {
+			agent = strings.TrimSpace(agent)
+			counted = agent == "googlebot" || agent == "robots"
+			token = strings.TrimSpace(rest)
+		}
+		if !counted {
+			continue
+		}
+
+		switch token {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex = true
+			d.NoFollow = true
+		}
+	}
+	return d
+}
+
+// parseRobotsValues reads every value of a robots meta tag or X-Robots-Tag
+// header on its own, so the crawler scope of one does not carry over to the
+// next.
+func parseRobotsValues(values []string) robotsDirectives {
+	var d robotsDirectives
+	for _, value := range values {
+		parsed := parseRobotsDirectives(value)
+		d.NoIndex = d.NoIndex || parsed.NoIndex
+		d.NoFollow = d.NoFollow || parsed.NoFollow
+	}
+	return d
+}
+
+// applyIndexability fills the indexability fields of the analysis from the
+// robots meta tag and X-Robots-Tag header values collected while crawling.
+func applyIndexability(analysis *Result, metaRobots, xRobotsTags []string) {
+	analysis.MetaRobots = strings.Join(metaRobots, ", ")
+	analysis.XRobotsTag = strings.Join(xRobotsTags, ", ")
+
+	meta := parseRobotsValues(metaRobots)
+	header := parseRobotsValues(xRobotsTags)
+
+	analysis.NoIndex = meta.NoIndex || header.NoIndex
+	analysis.NoFollow = meta.NoFollow || header.NoFollow
+	indexable := !analysis.NoIndex
+	analysis.Indexable = &indexable
+	analysis.IndexabilityWarning = indexabilityWarning(meta, header)
+}
+
+// indexabilityWarning describes why a page blocks indexing. A noindex sent
+// only in the response header is called out separately because it is
+// invisible in the page source and usually comes from server configuration.
+func indexabilityWarning(meta, header robotsDirectives) string {
+	switch {
+	case meta.NoIndex && header.NoIndex:
+		return "Page blocks indexing via robots meta tag and X-Robots-Tag header"
+	case header.NoIndex:
+		return "Page blocks indexing via X-Robots-Tag header only (not visible in page source)"
+	case meta.NoIndex:
+		return "Page blocks indexing via robots meta tag"
+	}
+	return ""
+}
@@ -0,0 +1,159 @@
+package analyzer
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// maxKeywords is how many words and bigrams are kept per analysis.
+const maxKeywords = 20
+
+// Elements whose text is not shown to readers.
+var hiddenTextElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+}
+
+// Stopwords per language, keyed by the primary subtag of the lang attribute.
+var stopwords = map[string]map[string]bool{
+	"en": wordSet(`a about above after again against all am an and any are as at be because been before being below between both but by can could did do does doing down during each few for from further had has have having he her here hers herself him himself his how i if in into is it its itself just me more most my myself no nor not now of off on once only or other our ours ourselves out over own same she should so some such than that the their theirs them themselves then there these they this those through to too under until up very was we were what when where which while who whom why will with would you your yours yourself yourselves`),
+	"de": wordSet(`aber alle als also am an auch auf aus bei bin bis bist da dann das dass dein dem den der des die dies dir doch du durch ein eine einem einen einer es für hab habe haben hat hatte ich ihr im in ist ja kann kein mein mit muss nach nein nicht noch nur ob oder sehr sein sich sie sind so über um und uns unser vom von vor war was weil wenn wer wie wir wird zu zum zur`),
+	"pl": wordSet(`a aby ale bez bo by był była było być czy dla do gdy go i ich im jak jako je jego jej jest jeszcze już ku lub ma mi mnie mu na nad nie nich niej o od oraz po pod przez przy się są ta tak także te tego tej ten to tu tylko tym w we więc z za ze że żeby`),
+	"fr": wordSet(`au aux avec ce ces dans de des du elle en et eux il ils je la le les leur lui ma mais me même mes moi mon ne nos notre nous on ou par pas pour qu que qui sa se ses son sur ta te tes toi ton tu un une vos votre vous est sont été être avoir`),
+	"es": wordSet(`a al algo como con de del el ella ellas ellos en entre era es esa ese eso esta este esto fue ha hay la las le les lo los me mi muy más no nos o para pero por que se sin sobre su sus también te tu un una uno y ya`),
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+// Keyword is a word or bigram and how often it occurs.
+type Keyword struct {
+	Term    string  `json:"term"`
+	Count   int     `json:"count"`
+	Density float64 `json:"density"`
+}
+
+// extractKeywords counts the words and bigrams of the visible text of doc.
+// Stopwords of the page language are left out and bigrams never span one.
+// The language comes from the lang attribute, or is guessed from the
+// stopwords found in the text when it is missing or unknown.
+func extractKeywords(doc *html.Node) (language string, wordCount int, words, bigrams []Keyword) {
+	var tokens []string
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		switch n.Type {
+		case html.ElementNode:
+			if hiddenTextElements[n.Data] {
+				return
+			}
+			if n.Data == "html" {
+				for _, attr := range n.Attr {
+					if attr.Key == "lang" {
+						language = strings.ToLower(strings.SplitN(strings.TrimSpace(attr.Val), "-", 2)[0])
+					}
+				}
+			}
+		case html.TextNode:
+			tokens = append(tokens, tokenize(n.Data)...)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+
+	if stopwords[language] == nil {
+		language = guessLanguage(tokens)
+	}
+	stop := stopwords[language]
+
+	wordCounts, bigramCounts := map[string]int{}, map[string]int{}
+	prev := ""
+	for _, token := range tokens {
+		wordCount++
+		if n := len([]rune(token)); stop[token] || n < 2 || n > 64 || isNumber(token) {
+			prev = ""
+			continue
+		}
+		wordCounts[token]++
+		if prev != "" {
+			bigramCounts[prev+" "+token]++
+		}
+		prev = token
+	}
+
+	return language, wordCount, topKeywords(wordCounts, wordCount), topKeywords(bigramCounts, wordCount)
+}
+
+// tokenize splits text into lower case words. Apostrophes and hyphens are
+// kept inside words only.
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '-'
+	})
+
+	tokens := fields[:0]
+	for _, field := range fields {
+		if token := strings.Trim(field, "'-"); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+func isNumber(token string) bool {
+	for _, r := range token {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// guessLanguage picks the language with the most stopwords in tokens,
+// defaulting to English.
+func guessLanguage(tokens []string) string {
+	best, bestHits := "en", 0
+	for _, language := range []string{"en", "de", "pl", "fr", "es"} {
+		hits := 0
+		for _, token := range tokens {
+			if stopwords[language][token] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = language, hits
+		}
+	}
+	return best
+}
+
+func topKeywords(counts map[string]int, wordCount int) []Keyword {
+	keywords := []Keyword{}
+	for term, count := range counts {
+		keywords = append(keywords, Keyword{Term: term, Count: count, Density: KeywordDensity(count, wordCount)})
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if keywords[i].Count != keywords[j].Count {
+			return keywords[i].Count > keywords[j].Count
+		}
+		return keywords[i].Term < keywords[j].Term
+	})
+	return keywords[:min(len(keywords), maxKeywords)]
+}
+
+// KeywordDensity is the share of the words of the text, in percent.
+func KeywordDensity(count, wordCount int) float64 {
+	if wordCount == 0 {
+		return 0
+	}
+	return math.Round(float64(count)/float64(wordCount)*10000) / 100
+}
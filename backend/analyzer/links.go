@@ -0,0 +1,284 @@
+package analyzer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Every checked link is timed and measured, and so are the scripts,
+// stylesheets, images and frames the page loads. The external ones of
+// those, hosted elsewhere than the analyzed page, are the page's third
+// party dependencies; the slowest and largest of them are reported.
+const (
+	DependencyReportSize = 5
+
+	// maxDependencies caps the resources of a page that are requested.
+	maxDependencies = 200
+
+	// maxDependencyBytes caps how much of a response body is read to
+	// measure it.
+	maxDependencyBytes = 50 << 20
+)
+
+// LinkCheck is the outcome of requesting a link.
+type LinkCheck struct {
+	URL            string `json:"url"`
+	Status         int    `json:"status,omitempty"`
+	Error          string `json:"error,omitempty"`
+	ErrorClass     string `json:"error_class,omitempty"`
+	RedirectStatus int    `json:"redirect_status,omitempty"`
+	FinalURL       string `json:"final_url,omitempty"`
+
+	// RedirectDecision is set when the redirect policy did not follow a
+	// redirect of the link.
+	RedirectDecision string `json:"redirect_decision,omitempty"`
+	DurationMS       int64  `json:"duration_ms"`
+	SizeBytes        int64  `json:"size_bytes"`
+	External         bool   `json:"external"`
+}
+
+// Broken reports whether the request failed or answered with a 4xx/5xx
+// status.
+func (l LinkCheck) Broken() bool {
+	return l.Error != "" || (l.Status >= 400 && l.Status <= 599)
+}
+
+// checkLink requests a link. A redirect to a target that must not be
+// requested is judged by the redirect response itself.
+func checkLink(ctx context.Context, link string, opts Options) LinkCheck {
+	var hops []RedirectHop
+	client := &http.Client{
+		Transport:     opts.httpTransport(),
+		Timeout:       opts.linkTimeout(),
+		CheckRedirect: opts.checkRedirect(http.ErrUseLastResponse, &hops),
+	}
+	check := requestLink(ctx, client, link, opts)
+
+	if len(hops) > 0 {
+		last := hops[len(hops)-1]
+		check.RedirectStatus, check.FinalURL = hops[0].Status, last.To
+		if last.Decision != redirectFollowed {
+			check.RedirectDecision = last.Decision
+		}
+	}
+	return check
+}
+
+func requestLink(ctx context.Context, client *http.Client, link string, opts Options) LinkCheck {
+	check := LinkCheck{URL: link}
+	start := time.Now()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		check.Error = err.Error()
+		check.ErrorClass = ErrorClassInvalidURL
+		return check
+	}
+	opts.prepareRequest(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		check.Error = err.Error()
+		check.ErrorClass = classifyLinkError(err)
+		check.DurationMS = time.Since(start).Milliseconds()
+		return check
+	}
+	defer resp.Body.Close()
+
+	check.Status = resp.StatusCode
+	check.ErrorClass = classifyStatus(resp.StatusCode)
+
+	// The duration covers the whole transfer, not just the headers.
+	read, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, maxDependencyBytes))
+	check.SizeBytes = max(read, resp.ContentLength)
+	check.DurationMS = time.Since(start).Milliseconds()
+	return check
+}
+
+// collectDependencies returns the URLs of the scripts, stylesheets, images
+// and frames the document loads, resolved against baseURL, in document
+// order and without duplicates.
+func collectDependencies(doc *html.Node, baseURL string) []string {
+	var dependencies []string
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return dependencies
+	}
+
+	seen := map[string]bool{}
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			var src string
+			switch n.Data {
+			case "script", "img", "iframe":
+				src = attrValue(n, "src")
+			case "link":
+				if slices.Contains(strings.Fields(strings.ToLower(attrValue(n, "rel"))), "stylesheet") {
+					src = attrValue(n, "href")
+				}
+			}
+			if u, err := url.Parse(strings.TrimSpace(src)); src != "" && err == nil {
+				resolved := base.ResolveReference(u)
+				if (resolved.Scheme == "http" || resolved.Scheme == "https") && !seen[resolved.String()] {
+					seen[resolved.String()] = true
+					dependencies = append(dependencies, resolved.String())
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return dependencies
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// checkDependencies requests the resources loaded by pageURL and returns
+// the outcome of each. At most maxDependencies are requested and checking
+// stops early when ctx is cancelled.
+func checkDependencies(ctx context.Context, pageURL string, dependencies []string, opts Options) []LinkCheck {
+	var checks []LinkCheck
+	for i, dependency := range dependencies[:min(len(dependencies), maxDependencies)] {
+		if ctx.Err() != nil {
+			break
+		}
+		if !opts.linkAllowed(dependency) {
+			continue
+		}
+		if i > 0 && opts.RequestDelayMS > 0 {
+			time.Sleep(opts.requestDelay())
+		}
+		checks = append(checks, checkLink(ctx, dependency, opts))
+	}
+
+	markExternal(checks, pageURL)
+	return checks
+}
+
+// FailedLinks returns the URLs of the broken links among checks.
+func FailedLinks(checks []LinkCheck) []string {
+	var Broken []string
+	for _, check := range checks {
+		if check.Broken() {
+			Broken = append(Broken, check.URL)
+		}
+	}
+	return Broken
+}
+
+// markExternal flags the checks of links hosted elsewhere than pageURL.
+func markExternal(checks []LinkCheck, pageURL string) {
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	for i := range checks {
+		if u, err := url.Parse(checks[i].URL); err == nil {
+			checks[i].External = u.Host != page.Host
+		}
+	}
+}
+
+// rankDependencies returns the slowest and the largest external
+// resources.
+func rankDependencies(checks []LinkCheck) ([]LinkCheck, []LinkCheck) {
+	var external []LinkCheck
+	for _, check := range checks {
+		if check.External {
+			external = append(external, check)
+		}
+	}
+
+	top := func(less func(a, b LinkCheck) bool) []LinkCheck {
+		ranked := append([]LinkCheck{}, external...)
+		sort.SliceStable(ranked, func(i, j int) bool { return less(ranked[i], ranked[j]) })
+		return ranked[:min(len(ranked), DependencyReportSize)]
+	}
+	slowest := top(func(a, b LinkCheck) bool { return a.DurationMS > b.DurationMS })
+	largest := top(func(a, b LinkCheck) bool { return a.SizeBytes > b.SizeBytes })
+	return slowest, largest
+}
+
+// Error classes of link checks, used to suggest a remediation.
+const (
+	ErrorClassNotFound            = "not_found"
+	ErrorClassGone                = "gone"
+	ErrorClassUnauthorized        = "unauthorized"
+	ErrorClassClientError         = "client_error"
+	ErrorClassServerError         = "server_error"
+	ErrorClassTimeout             = "timeout"
+	ErrorClassDNS                 = "dns"
+	ErrorClassConnectionRefused   = "connection_refused"
+	ErrorClassTLS                 = "tls"
+	ErrorClassTLSExpired          = "tls_expired"
+	ErrorClassTLSHostnameMismatch = "tls_hostname_mismatch"
+	ErrorClassTLSUnknownAuthority = "tls_unknown_authority"
+	ErrorClassTooManyRedirects    = "too_many_redirects"
+	ErrorClassInsecureRedirect    = "insecure_redirect"
+	ErrorClassInvalidURL          = "invalid_url"
+	ErrorClassRequestFailed       = "request_failed"
+	ErrorClassPermanentRedirect   = "permanent_redirect"
+	ErrorClassBlocked             = "blocked"
+)
+
+// classifyLinkError returns the error class of a failed request.
+func classifyLinkError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	tlsClass := classifyTLSError(err)
+	switch {
+	case errors.Is(err, ErrTargetBlocked):
+		return ErrorClassBlocked
+	case errors.Is(err, errTooManyRedirects):
+		return ErrorClassTooManyRedirects
+	case errors.Is(err, errInsecureRedirect):
+		return ErrorClassInsecureRedirect
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ErrorClassConnectionRefused
+	case tlsClass != "":
+		return tlsClass
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	}
+	return ErrorClassRequestFailed
+}
+
+// classifyStatus returns the error class of a 4xx/5xx answer.
+func classifyStatus(status int) string {
+	switch {
+	case status == http.StatusNotFound:
+		return ErrorClassNotFound
+	case status == http.StatusGone:
+		return ErrorClassGone
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorClassUnauthorized
+	case status >= 400 && status <= 499:
+		return ErrorClassClientError
+	case status >= 500 && status <= 599:
+		return ErrorClassServerError
+	}
+	return ""
+}
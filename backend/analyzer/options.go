@@ -0,0 +1,260 @@
+package analyzer
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"time"
+
+	"challenge-sykell/backend/dbjson"
+)
+
+// Options tunes how a page and its links are fetched. Zero values
+// fall back to the defaults. Projects store a set of defaults and each
+// analysis may carry overrides layered on top of them.
+type Options struct {
+	UserAgent          string   `json:"user_agent,omitempty" binding:"max=512"`
+	TimeoutSeconds     int      `json:"timeout_seconds,omitempty" binding:"min=0,max=300"`
+	LinkTimeoutSeconds int      `json:"link_timeout_seconds,omitempty" binding:"min=0,max=120"`
+	MaxLinks           int      `json:"max_links,omitempty" binding:"min=0,max=10000"`
+	ExcludeLinks       []string `json:"exclude_links,omitempty" binding:"max=50,dive,max=512,regexp"`
+	RequestDelayMS     int      `json:"request_delay_ms,omitempty" binding:"min=0,max=60000"`
+
+	// Checks lists the checks to run, all of them when empty.
+	Checks []string `json:"checks,omitempty" binding:"max=10,dive,oneof=links validation keywords seo indexability"`
+
+	// Redirect policy: FollowRedirects false answers with the redirect
+	// itself, MaxRedirects caps the hops followed and
+	// RejectInsecureRedirects fails redirects from https to http.
+	FollowRedirects         *bool `json:"follow_redirects,omitempty"`
+	MaxRedirects            int   `json:"max_redirects,omitempty" binding:"min=0,max=20"`
+	RejectInsecureRedirects *bool `json:"reject_insecure_redirects,omitempty"`
+
+	// DebugCapture records the page requests so failed runs can be
+	// inspected; Capture receives the recording.
+	DebugCapture *bool    `json:"debug_capture,omitempty"`
+	Capture      *Capture `json:"-"`
+
+	// RenderJS is reserved for rendering pages in a browser. The built-in
+	// fetcher only analyzes the server rendered HTML, so it must be false.
+	RenderJS *bool `json:"render_js,omitempty" binding:"omitempty,unsupported"`
+
+	// Validators from the previous run, sent as conditional headers on the
+	// page request.
+	IfNoneMatch     string `json:"-"`
+	IfModifiedSince string `json:"-"`
+
+	// TLS options, see tls.go.
+	CABundle           string `json:"ca_bundle,omitempty" binding:"omitempty,max=65536,pemcerts"`
+	InsecureSkipVerify *bool  `json:"insecure_skip_verify,omitempty" binding:"omitempty,projectonly"`
+
+	// Credentials are only sent to the host of the analyzed page. The
+	// backend stores them in their own encrypted columns.
+	Credentials Credentials `json:"-"`
+	pageHost    string
+	transport   http.RoundTripper
+
+	// TargetAllowed, if set, reports whether a URL may be requested. Pages
+	// and redirects to other URLs fail, other links are skipped.
+	TargetAllowed func(*url.URL) bool `json:"-"`
+
+	// AddressAllowed, if set, reports whether connections to an address
+	// may be made. Requests to other addresses fail.
+	AddressAllowed func(netip.Addr) bool `json:"-"`
+}
+
+// Credentials are sent with the requests to the analyzed host.
+type Credentials struct {
+	Cookies           string
+	BasicAuthUser     string
+	BasicAuthPassword string
+}
+
+const (
+	defaultTimeoutSeconds     = 30
+	defaultLinkTimeoutSeconds = 10
+)
+
+func (o Options) PageTimeout() time.Duration {
+	if o.TimeoutSeconds > 0 {
+		return time.Duration(o.TimeoutSeconds) * time.Second
+	}
+	return defaultTimeoutSeconds * time.Second
+}
+
+func (o Options) linkTimeout() time.Duration {
+	if o.LinkTimeoutSeconds > 0 {
+		return time.Duration(o.LinkTimeoutSeconds) * time.Second
+	}
+	return defaultLinkTimeoutSeconds * time.Second
+}
+
+func (o Options) requestDelay() time.Duration {
+	return time.Duration(o.RequestDelayMS) * time.Millisecond
+}
+
+// prepareRequest applies request level options such as the user agent and,
+// for requests to the analyzed host, the crawl credentials.
+func (o Options) prepareRequest(req *http.Request) {
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+
+	if o.pageHost == "" || req.URL.Host != o.pageHost {
+		return
+	}
+	if o.Credentials.Cookies != "" {
+		req.Header.Set("Cookie", o.Credentials.Cookies)
+	}
+	if o.Credentials.BasicAuthUser != "" {
+		req.SetBasicAuth(o.Credentials.BasicAuthUser, o.Credentials.BasicAuthPassword)
+	}
+}
+
+// checkEnabled reports whether the named check runs.
+func (o Options) checkEnabled(name string) bool {
+	return len(o.Checks) == 0 || slices.Contains(o.Checks, name)
+}
+
+// analysisChecks are the checks Checks can choose from.
+var analysisChecks = []string{"links", "validation", "keywords", "seo", "indexability"}
+
+// skippedChecks lists the checks that do not run.
+func (o Options) skippedChecks() CheckList {
+	skipped := CheckList{}
+	for _, name := range analysisChecks {
+		if !o.checkEnabled(name) {
+			skipped = append(skipped, name)
+		}
+	}
+	return skipped
+}
+
+// CheckList is a list of check names stored as JSON.
+type CheckList []string
+
+// Scan reads a list stored as JSON. NULL reads as an empty list.
+func (l *CheckList) Scan(src any) error {
+	if err := dbjson.Scan(l, src); err != nil {
+		return err
+	}
+	if *l == nil {
+		*l = CheckList{}
+	}
+	return nil
+}
+
+// Value stores the list as JSON.
+func (l CheckList) Value() (driver.Value, error) {
+	return dbjson.Value(l)
+}
+
+// Without returns the list without name.
+func (l CheckList) Without(name string) CheckList {
+	return slices.DeleteFunc(slices.Clone(l), func(n string) bool { return n == name })
+}
+
+func (o Options) targetAllowed(u *url.URL) bool {
+	return o.TargetAllowed == nil || o.TargetAllowed(u)
+}
+
+func (o Options) linkAllowed(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && o.targetAllowed(u)
+}
+
+// scopeToPage limits the credentials and skipped certificate verification
+// to the host of pageURL and prepares the transport of the run.
+func (o *Options) scopeToPage(pageURL string) error {
+	if u, err := url.Parse(pageURL); err == nil {
+		o.pageHost = u.Host
+	}
+	return o.prepareTransport()
+}
+
+// Merge layers override on top of o: every option set in override wins.
+func (o Options) Merge(override Options) Options {
+	if override.UserAgent != "" {
+		o.UserAgent = override.UserAgent
+	}
+	if override.TimeoutSeconds != 0 {
+		o.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.LinkTimeoutSeconds != 0 {
+		o.LinkTimeoutSeconds = override.LinkTimeoutSeconds
+	}
+	if override.MaxLinks != 0 {
+		o.MaxLinks = override.MaxLinks
+	}
+	if override.ExcludeLinks != nil {
+		o.ExcludeLinks = override.ExcludeLinks
+	}
+	if override.RequestDelayMS != 0 {
+		o.RequestDelayMS = override.RequestDelayMS
+	}
+	if override.Checks != nil {
+		o.Checks = override.Checks
+	}
+	if override.FollowRedirects != nil {
+		o.FollowRedirects = override.FollowRedirects
+	}
+	if override.MaxRedirects != 0 {
+		o.MaxRedirects = override.MaxRedirects
+	}
+	if override.RejectInsecureRedirects != nil {
+		o.RejectInsecureRedirects = override.RejectInsecureRedirects
+	}
+	if override.DebugCapture != nil {
+		o.DebugCapture = override.DebugCapture
+	}
+	if override.CABundle != "" {
+		o.CABundle = override.CABundle
+	}
+	if override.InsecureSkipVerify != nil {
+		o.InsecureSkipVerify = override.InsecureSkipVerify
+	}
+	if override.RenderJS != nil {
+		o.RenderJS = override.RenderJS
+	}
+	if override.IfNoneMatch != "" {
+		o.IfNoneMatch = override.IfNoneMatch
+	}
+	if override.IfModifiedSince != "" {
+		o.IfModifiedSince = override.IfModifiedSince
+	}
+	return o
+}
+
+// excludeMatcher returns a function reporting whether a link matches one of
+// the exclude patterns. Patterns are validated before they are stored, so
+// invalid ones are skipped here.
+func (o Options) excludeMatcher() func(string) bool {
+	var patterns []*regexp.Regexp
+	for _, pattern := range o.ExcludeLinks {
+		if re, err := regexp.Compile(pattern); err == nil {
+			patterns = append(patterns, re)
+		}
+	}
+
+	return func(link string) bool {
+		for _, re := range patterns {
+			if re.MatchString(link) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Scan reads options stored as JSON. NULL reads as no options.
+func (o *Options) Scan(src any) error {
+	return dbjson.Scan(o, src)
+}
+
+// Value stores options as JSON.
+func (o Options) Value() (driver.Value, error) {
+	return dbjson.Value(o)
+}
@@ -0,0 +1,97 @@
+package analyzer
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/net/html"
+)
+
+// Heading is an entry of the heading outline of a page.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+}
+
+var headingLevels = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+// extractOutline returns the headings of doc in document order, as
+// assistive technology reads them: elements hidden from it are left out,
+// role="heading" elements count and aria-level overrides the level.
+func extractOutline(doc *html.Node) []Heading {
+	var outline []Heading
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if hiddenTextElements[n.Data] || hiddenFromReaders(n) {
+				return
+			}
+			if level, ok := headingLevel(n); ok {
+				outline = append(outline, Heading{Level: level, Text: elementText(n)})
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(doc)
+	return outline
+}
+
+func hiddenFromReaders(n *html.Node) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == "hidden" || (attr.Key == "aria-hidden" && attr.Val == "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// headingLevel returns the level of a heading element.
+func headingLevel(n *html.Node) (int, bool) {
+	level, ok := headingLevels[n.Data]
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "role":
+			if attr.Val == "heading" {
+				ok = true
+				if level == 0 {
+					level = 2
+				}
+			}
+		case "aria-level":
+			if l, err := strconv.Atoi(attr.Val); err == nil && l >= 1 && l <= 6 {
+				level = l
+			}
+		}
+	}
+	return level, ok
+}
+
+// OutlineIssues points out structural problems of an outline: a missing or
+// repeated h1, skipped levels and empty headings.
+func OutlineIssues(outline []Heading) []string {
+	issues := []string{}
+	h1s, prev := 0, 0
+	for i, h := range outline {
+		if h.Level == 1 {
+			h1s++
+		}
+		if h.Text == "" {
+			issues = append(issues, fmt.Sprintf("Heading %d (h%d) is empty", i+1, h.Level))
+		}
+		if prev != 0 && h.Level > prev+1 {
+			issues = append(issues, fmt.Sprintf("Heading %d skips from h%d to h%d", i+1, prev, h.Level))
+		}
+		prev = h.Level
+	}
+
+	switch {
+	case h1s == 0:
+		issues = append([]string{"The page has no h1 heading"}, issues...)
+	case h1s > 1:
+		issues = append([]string{fmt.Sprintf("The page has %d h1 headings", h1s)}, issues...)
+	}
+	return issues
+}
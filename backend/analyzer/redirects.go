@@ -0,0 +1,95 @@
+package analyzer
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"challenge-sykell/backend/dbjson"
+)
+
+// defaultMaxRedirects is how many redirects are followed unless the options
+// set another limit.
+const defaultMaxRedirects = 10
+
+// Decisions taken by the redirect policy for a redirect.
+const (
+	redirectFollowed        = "followed"
+	redirectNotFollowed     = "not_followed"
+	redirectMaxHopsExceeded = "max_hops_exceeded"
+	redirectInsecure        = "rejected_insecure"
+	redirectBlocked         = "blocked"
+)
+
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errInsecureRedirect = errors.New("redirect from https to http")
+)
+
+// RedirectHop is a redirect answered by a server and what the policy did
+// about it.
+type RedirectHop struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Status   int    `json:"status"`
+	Decision string `json:"decision"`
+}
+
+func (o Options) followRedirects() bool {
+	return o.FollowRedirects == nil || *o.FollowRedirects
+}
+
+func (o Options) maxRedirects() int {
+	if o.MaxRedirects > 0 {
+		return o.MaxRedirects
+	}
+	return defaultMaxRedirects
+}
+
+// checkRedirect returns an http.Client CheckRedirect function applying the
+// redirect options and target rules. blocked is returned for redirects to
+// targets that must not be requested. Every redirect is appended to hops.
+func (o Options) checkRedirect(blocked error, hops *[]RedirectHop) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		prev := via[len(via)-1]
+		hop := RedirectHop{From: prev.URL.String(), To: req.URL.String(), Decision: redirectFollowed}
+		if req.Response != nil {
+			hop.Status = req.Response.StatusCode
+		}
+
+		var err error
+		switch {
+		case !o.followRedirects():
+			hop.Decision, err = redirectNotFollowed, http.ErrUseLastResponse
+		case len(via) > o.maxRedirects():
+			hop.Decision, err = redirectMaxHopsExceeded, fmt.Errorf("%w: more than %d", errTooManyRedirects, o.maxRedirects())
+		case o.RejectInsecureRedirects != nil && *o.RejectInsecureRedirects && prev.URL.Scheme == "https" && req.URL.Scheme == "http":
+			hop.Decision, err = redirectInsecure, errInsecureRedirect
+		case !o.targetAllowed(req.URL):
+			hop.Decision, err = redirectBlocked, blocked
+		}
+
+		*hops = append(*hops, hop)
+		return err
+	}
+}
+
+// RedirectChain is stored as JSON with the analysis.
+type RedirectChain []RedirectHop
+
+// Scan reads a chain stored as JSON. NULL reads as no redirects.
+func (r *RedirectChain) Scan(src any) error {
+	if err := dbjson.Scan(r, src); err != nil {
+		return err
+	}
+	if *r == nil {
+		*r = RedirectChain{}
+	}
+	return nil
+}
+
+// Value stores the chain as JSON.
+func (r RedirectChain) Value() (driver.Value, error) {
+	return dbjson.Value(r)
+}
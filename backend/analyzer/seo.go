@@ -0,0 +1,121 @@
+package analyzer
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+
+	"challenge-sykell/backend/dbjson"
+)
+
+// Search results cut titles and descriptions by rendered width rather than
+// by characters, so lengths are judged on an estimated pixel width. The
+// estimate weighs each character by its typical width in the result font,
+// which keeps the verdicts meaningful for scripts such as CJK where a
+// character is about twice as wide as a Latin letter.
+
+// textLimits are the display limits of a result element.
+type textLimits struct {
+	fontSize float64
+	minWidth int
+	maxWidth int
+}
+
+var (
+	titleLimits       = textLimits{fontSize: 20, minWidth: 200, maxWidth: 580}
+	descriptionLimits = textLimits{fontSize: 14, minWidth: 400, maxWidth: 920}
+)
+
+// Verdicts of a length check.
+const (
+	lengthOK       = "ok"
+	lengthMissing  = "missing"
+	lengthTooShort = "too_short"
+	lengthTooLong  = "too_long"
+)
+
+// LengthCheck is the verdict on the length of a title or description.
+type LengthCheck struct {
+	Length     int    `json:"length"`
+	PixelWidth int    `json:"pixel_width"`
+	Verdict    string `json:"verdict"`
+	Truncated  bool   `json:"truncated"`
+	Message    string `json:"message"`
+}
+
+// SEOReport holds the snippet checks of a page.
+type SEOReport struct {
+	MetaDescription string      `json:"meta_description"`
+	Title           LengthCheck `json:"title"`
+	Description     LengthCheck `json:"description"`
+}
+
+// checkSnippet judges the title and meta description of a page.
+func checkSnippet(title, description string) SEOReport {
+	return SEOReport{
+		MetaDescription: description,
+		Title:           checkLength("title", title, titleLimits),
+		Description:     checkLength("meta description", description, descriptionLimits),
+	}
+}
+
+func checkLength(name, text string, limits textLimits) LengthCheck {
+	text = strings.Join(strings.Fields(text), " ")
+	check := LengthCheck{
+		Length:     len([]rune(text)),
+		PixelWidth: textWidth(text, limits.fontSize),
+		Verdict:    lengthOK,
+	}
+
+	switch {
+	case text == "":
+		check.Verdict = lengthMissing
+		check.Message = fmt.Sprintf("The page has no %s", name)
+	case check.PixelWidth < limits.minWidth:
+		check.Verdict = lengthTooShort
+		check.Message = fmt.Sprintf("The %s is about %dpx wide; aim for at least %dpx", name, check.PixelWidth, limits.minWidth)
+	case check.PixelWidth > limits.maxWidth:
+		check.Verdict = lengthTooLong
+		check.Truncated = true
+		check.Message = fmt.Sprintf("The %s is about %dpx wide and will be truncated after about %dpx", name, check.PixelWidth, limits.maxWidth)
+	}
+	return check
+}
+
+// textWidth estimates the rendered width of text in pixels.
+func textWidth(text string, fontSize float64) int {
+	var em float64
+	for _, r := range text {
+		em += charWidth(r)
+	}
+	return int(math.Round(em * fontSize))
+}
+
+// charWidth is the approximate width of r in em in a sans-serif font.
+func charWidth(r rune) float64 {
+	switch {
+	case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || (r >= 0xFF01 && r <= 0xFF60):
+		return 1
+	case strings.ContainsRune("iljtfrI.,:;!|' ", r):
+		return 0.28
+	case strings.ContainsRune("mwMW", r):
+		return 0.85
+	case unicode.IsUpper(r):
+		return 0.65
+	case unicode.IsLower(r) || unicode.IsDigit(r):
+		return 0.5
+	}
+	return 0.55
+}
+
+// Scan reads a report stored as JSON. NULL reads as an empty report.
+func (s *SEOReport) Scan(src any) error {
+	return dbjson.Scan(s, src)
+}
+
+// Value stores the report as JSON.
+func (s SEOReport) Value() (driver.Value, error) {
+	return dbjson.Value(s)
+}
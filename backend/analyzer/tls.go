@@ -0,0 +1,147 @@
+package analyzer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// Internal hosts such as staging servers often use certificates the system
+// does not trust. CABundle adds PEM encoded certificates to the system
+// roots for every request of a run; InsecureSkipVerify turns verification
+// off for the host of the analyzed page only, so links to other hosts are
+// still verified. Only project settings may turn it off, so it is decided
+// once per site rather than with every submission.
+
+var errNoCertificates = errors.New("CA bundle contains no PEM encoded certificates")
+
+// certPool returns the system roots with the certificates of bundle added.
+func certPool(bundle string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM([]byte(bundle)) {
+		return nil, errNoCertificates
+	}
+	return pool, nil
+}
+
+// prepareTransport builds the transport applying the TLS options and the
+// address rules. It is built once per run so connections are reused across
+// requests.
+func (o *Options) prepareTransport() error {
+	insecure := o.InsecureSkipVerify != nil && *o.InsecureSkipVerify
+	if o.CABundle == "" && !insecure && o.AddressAllowed == nil {
+		o.transport = nil
+		return nil
+	}
+
+	config := &tls.Config{}
+	if o.CABundle != "" {
+		pool, err := certPool(o.CABundle)
+		if err != nil {
+			return err
+		}
+		config.RootCAs = pool
+	}
+
+	secure := o.baseTransport()
+	secure.TLSClientConfig = config
+	o.transport = secure
+	if insecure && o.pageHost != "" {
+		skipping := o.baseTransport()
+		skipping.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		o.transport = hostTransport{host: o.pageHost, insecure: skipping, secure: secure}
+	}
+	return nil
+}
+
+// baseTransport returns a copy of the default transport that only dials
+// addresses AddressAllowed accepts. The check runs on the resolved address
+// right before connecting, so neither DNS nor redirects get around it. A
+// proxy would connect on the crawler's behalf, so none is used then.
+func (o *Options) baseTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if o.AddressAllowed == nil {
+		return transport
+	}
+
+	allowed := o.AddressAllowed
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil || !allowed(addrPort.Addr().Unmap()) {
+				return ErrTargetBlocked
+			}
+			return nil
+		},
+	}
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// httpTransport is the transport requests of the run are sent with.
+func (o Options) httpTransport() http.RoundTripper {
+	if o.transport != nil {
+		return o.transport
+	}
+	return http.DefaultTransport
+}
+
+// closeIdleConnections closes the idle connections of the transport built
+// for the run, which is not reused once the run is over.
+func (o Options) closeIdleConnections() {
+	if transport, ok := o.transport.(interface{ CloseIdleConnections() }); ok {
+		transport.CloseIdleConnections()
+	}
+}
+
+// hostTransport skips certificate verification for requests to host.
+type hostTransport struct {
+	host     string
+	insecure *http.Transport
+	secure   *http.Transport
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.host {
+		return t.insecure.RoundTrip(req)
+	}
+	return t.secure.RoundTrip(req)
+}
+
+func (t hostTransport) CloseIdleConnections() {
+	t.insecure.CloseIdleConnections()
+	t.secure.CloseIdleConnections()
+}
+
+// classifyTLSError returns the error class of a failed TLS handshake, or
+// "" when err is not one.
+func classifyTLSError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	var verifyErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alert tls.AlertError
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return ErrorClassTLSUnknownAuthority
+	case errors.As(err, &hostnameErr):
+		return ErrorClassTLSHostnameMismatch
+	case errors.As(err, &certErr) && certErr.Reason == x509.Expired:
+		return ErrorClassTLSExpired
+	case errors.As(err, &certErr), errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alert):
+		return ErrorClassTLS
+	}
+	return ""
+}
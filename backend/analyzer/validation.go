@@ -0,0 +1,127 @@
+package analyzer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"golang.org/x/net/html"
+)
+
+// maxValidationFindings caps the findings stored per analysis; the count
+// still includes every finding.
+const maxValidationFindings = 50
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// Elements whose end tag may be omitted, so leaving them open is not an error.
+var optionalEndTagElements = map[string]bool{
+	"html": true, "head": true, "body": true, "p": true, "li": true, "dt": true, "dd": true,
+	"tr": true, "td": true, "th": true, "thead": true, "tbody": true, "tfoot": true,
+	"option": true, "optgroup": true, "colgroup": true, "rb": true, "rt": true, "rp": true,
+}
+
+var deprecatedElements = map[string]bool{
+	"font": true, "center": true, "marquee": true, "blink": true, "big": true, "strike": true,
+	"tt": true, "acronym": true, "applet": true, "basefont": true, "dir": true, "frame": true,
+	"frameset": true, "noframes": true, "isindex": true,
+}
+
+type openElement struct {
+	name string
+	line int
+}
+
+// validationResult collects structural problems found in a document.
+type validationResult struct {
+	count    int
+	findings []string
+}
+
+func (r *validationResult) add(line int, format string, args ...any) {
+	r.count++
+	if len(r.findings) < maxValidationFindings {
+		r.findings = append(r.findings, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, args...))
+	}
+}
+
+// validateHTML tokenizes the raw document and reports unclosed and
+// misnested tags, duplicate id attributes and deprecated elements.
+func validateHTML(body []byte) (int, []string) {
+	var result validationResult
+	var stack []openElement
+	ids := map[string]int{}
+	line := 1
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				result.add(line, "tokenizer error: %v", z.Err())
+			}
+			break
+		}
+
+		tokenLine := line
+		line += bytes.Count(z.Raw(), []byte("\n"))
+		token := z.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name := token.Data
+			if deprecatedElements[name] {
+				result.add(tokenLine, "deprecated element <%s>", name)
+			}
+			for _, attr := range token.Attr {
+				if attr.Key != "id" || attr.Val == "" {
+					continue
+				}
+				if first, ok := ids[attr.Val]; ok {
+					result.add(tokenLine, "duplicate id %q (first used on line %d)", attr.Val, first)
+				} else {
+					ids[attr.Val] = tokenLine
+				}
+			}
+			if tt == html.StartTagToken && !voidElements[name] {
+				stack = append(stack, openElement{name: name, line: tokenLine})
+			}
+		case html.EndTagToken:
+			name := token.Data
+			if voidElements[name] {
+				result.add(tokenLine, "end tag </%s> for void element", name)
+				continue
+			}
+
+			match := -1
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].name == name {
+					match = i
+					break
+				}
+			}
+			if match < 0 {
+				result.add(tokenLine, "unexpected end tag </%s>", name)
+				continue
+			}
+
+			for _, open := range stack[match+1:] {
+				if !optionalEndTagElements[open.name] {
+					result.add(tokenLine, "<%s> opened on line %d is not closed before </%s>", open.name, open.line, name)
+				}
+			}
+			stack = stack[:match]
+		}
+	}
+
+	for _, open := range stack {
+		if !optionalEndTagElements[open.name] {
+			result.add(open.line, "<%s> is never closed", open.name)
+		}
+	}
+
+	return result.count, result.findings
+}
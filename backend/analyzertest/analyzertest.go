@@ -0,0 +1,233 @@
+// Package analyzertest serves fixture sites from in-memory httptest servers
+// and runs the page analyzer against them, so the analyzer can be tested
+// deterministically without network access.
+//
+// The fixtures cover broken links, redirects and login forms. A second
+// server stands in for an external host. Run analyzes every fixture page
+// and compares what was found with the expected Result:
+//
+//	func TestAnalyze(t *testing.T) {
+//		analyzertest.Run(t)
+//	}
+package analyzertest
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+//go:embed fixtures/*.html
+var fixtureFiles embed.FS
+
+// runTimeout bounds the analysis of a single fixture page.
+const runTimeout = 30 * time.Second
+
+// Result is what the analyzer found on a fixture page.
+type Result struct {
+	Title         string
+	InternalLinks int
+	ExternalLinks int
+	BrokenLinks   []string
+	HasLoginForm  bool
+
+	// Redirects is the number of redirects followed to reach the page.
+	Redirects int
+}
+
+// Fixture is a fixture page and what the analyzer is expected to find.
+type Fixture struct {
+	Name string
+	Path string
+	Want Result
+}
+
+// Server serves the fixture site and the external host its pages link to.
+type Server struct {
+	site     *httptest.Server
+	external *httptest.Server
+}
+
+// NewServer starts the fixture servers. Close stops them.
+func NewServer() *Server {
+	s := &Server{}
+	s.external = httptest.NewServer(s.handler())
+	s.site = httptest.NewServer(s.handler())
+	return s
+}
+
+// Close stops the fixture servers.
+func (s *Server) Close() {
+	s.site.Close()
+	s.external.Close()
+}
+
+// URL returns the absolute URL of path on the fixture site.
+func (s *Server) URL(path string) string {
+	return s.site.URL + path
+}
+
+// ExternalURL returns the absolute URL of path on the external host.
+func (s *Server) ExternalURL(path string) string {
+	return s.external.URL + path
+}
+
+// Fixtures lists the fixture pages with their expected results.
+func (s *Server) Fixtures() []Fixture {
+	return []Fixture{
+		{
+			Name: "broken-links",
+			Path: "/broken-links",
+			Want: Result{
+				Title:         "Broken links",
+				InternalLinks: 4,
+				ExternalLinks: 2,
+				BrokenLinks:   []string{s.URL("/missing"), s.URL("/gone"), s.URL("/error"), s.ExternalURL("/missing")},
+			},
+		},
+		{
+			Name: "redirects",
+			Path: "/redirect/page",
+			Want: Result{
+				Title:         "Redirects",
+				InternalLinks: 3,
+				BrokenLinks:   []string{s.URL("/redirect/loop")},
+				Redirects:     1,
+			},
+		},
+		{
+			Name: "login-form",
+			Path: "/login-form",
+			Want: Result{
+				Title:        "Sign in",
+				HasLoginForm: true,
+			},
+		},
+	}
+}
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{fixture}", func(w http.ResponseWriter, r *http.Request) {
+		page, err := fixtureFiles.ReadFile("fixtures/" + r.PathValue("fixture") + ".html")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(strings.ReplaceAll(string(page), "{{external}}", s.external.URL)))
+	})
+
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<!DOCTYPE html><html><head><title>OK</title></head><body>OK</body></html>"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gone", http.StatusGone)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	})
+
+	redirects := map[string]struct {
+		to     string
+		status int
+	}{
+		"/redirect/page":      {"/redirects", http.StatusMovedPermanently},
+		"/redirect/permanent": {"/ok", http.StatusMovedPermanently},
+		"/redirect/chain":     {"/redirect/permanent", http.StatusFound},
+		"/redirect/loop":      {"/redirect/loop", http.StatusFound},
+	}
+	for from, target := range redirects {
+		mux.HandleFunc(from, func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.to, target.status)
+		})
+	}
+	return mux
+}
+
+// Analyze analyzes the page at url with the default options and reports
+// what was found.
+func Analyze(ctx context.Context, url string) (Result, error) {
+	a, err := analyzer.Analyze(ctx, url, analyzer.Options{}, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Title:         a.Title,
+		InternalLinks: a.InternalLinks,
+		ExternalLinks: a.ExternalLinks,
+		BrokenLinks:   a.BrokenLinks,
+		HasLoginForm:  a.HasLoginForm,
+		Redirects:     len(a.Redirects),
+	}, nil
+}
+
+// Run analyzes every fixture page in a subtest and reports where the
+// result differs from the expected one. Broken links are compared
+// regardless of their order.
+func Run(t *testing.T) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+
+	for _, f := range s.Fixtures() {
+		t.Run(f.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+			defer cancel()
+
+			got, err := Analyze(ctx, s.URL(f.Path))
+			if err != nil {
+				t.Fatalf("analyze %s: %v", f.Path, err)
+			}
+			for _, problem := range Compare(f.Want, got) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// Compare lists the differences between an expected and an actual result.
+func Compare(want, got Result) []string {
+	var problems []string
+	report := func(field string, want, got any) {
+		problems = append(problems, fmt.Sprintf("%s: want %v, got %v", field, want, got))
+	}
+
+	if got.Title != want.Title {
+		report("title", want.Title, got.Title)
+	}
+	if got.InternalLinks != want.InternalLinks {
+		report("internal links", want.InternalLinks, got.InternalLinks)
+	}
+	if got.ExternalLinks != want.ExternalLinks {
+		report("external links", want.ExternalLinks, got.ExternalLinks)
+	}
+	if wantLinks, gotLinks := sorted(want.BrokenLinks), sorted(got.BrokenLinks); !slices.Equal(wantLinks, gotLinks) {
+		report("broken links", wantLinks, gotLinks)
+	}
+	if got.HasLoginForm != want.HasLoginForm {
+		report("login form", want.HasLoginForm, got.HasLoginForm)
+	}
+	if got.Redirects != want.Redirects {
+		report("redirects", want.Redirects, got.Redirects)
+	}
+	return problems
+}
+
+func sorted(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return values
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Request bodies declare their limits with binding tags. Besides the
+// built-in rules, httpurl accepts absolute http and https URLs, regexp
+// accepts patterns that compile, pemcerts accepts PEM encoded certificates,
+// unsupported rejects enabling a feature that is not implemented and
+// projectonly rejects setting a field outside of project bodies.
+
+func registerValidators() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	// Report fields by their JSON names.
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	v.RegisterValidation("httpurl", func(fl validator.FieldLevel) bool {
+		u, err := url.Parse(fl.Field().String())
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	})
+	v.RegisterValidation("regexp", func(fl validator.FieldLevel) bool {
+		_, err := regexp.Compile(fl.Field().String())
+		return err == nil
+	})
+	v.RegisterValidation("pemcerts", func(fl validator.FieldLevel) bool {
+		return x509.NewCertPool().AppendCertsFromPEM([]byte(fl.Field().String()))
+	})
+	v.RegisterValidation("unsupported", func(fl validator.FieldLevel) bool {
+		return fl.Field().IsZero()
+	})
+	v.RegisterValidation("projectonly", func(fl validator.FieldLevel) bool {
+		_, project := reflect.Indirect(fl.Top()).Interface().(projectBody)
+		return project || fl.Field().IsZero()
+	})
+}
+
+// bindBody decodes and validates a JSON request body, answering the request
+// with the offending fields when it is invalid.
+func bindBody(c *gin.Context, body any) bool {
+	err := c.ShouldBindJSON(body)
+	if err == nil {
+		return true
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return false
+	}
+
+	// Namespaces start with the type name of named body structs.
+	prefix := reflect.TypeOf(body).Elem().Name()
+	if prefix != "" {
+		prefix += "."
+	}
+
+	fields := map[string]string{}
+	for _, fe := range invalid {
+		fields[strings.TrimPrefix(fe.Namespace(), prefix)] = fieldErrorMessage(fe)
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": fields})
+	return false
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	kind := fe.Kind()
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "httpurl":
+		return "must be an absolute http or https URL"
+	case "regexp":
+		return "must be a valid regular expression"
+	case "pemcerts":
+		return "must contain PEM encoded certificates"
+	case "unsupported":
+		return "is not supported yet"
+	case "projectonly":
+		return "is only allowed in project settings"
+	case "min", "gte":
+		if kind == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		switch kind {
+		case reflect.String:
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		case reflect.Slice, reflect.Map:
+			return fmt.Sprintf("must have at most %s items", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	}
+	return "is invalid"
+}
@@ -0,0 +1,41 @@
+// Package dbjson stores values in JSON columns. Types kept in such a
+// column implement sql.Scanner and driver.Valuer with Scan and Value.
+package dbjson
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// Scan reads a value stored by Value into dst. NULL and empty
+// values read as the zero value.
+func Scan[T any](dst *T, src any) error {
+	var zero T
+	*dst = zero
+
+	var encoded []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		encoded = v
+	case string:
+		encoded = []byte(v)
+	default:
+		return fmt.Errorf("cannot scan %T into %T", src, *dst)
+	}
+	if len(encoded) == 0 {
+		return nil
+	}
+	return json.Unmarshal(encoded, dst)
+}
+
+// Value stores v as JSON.
+func Value(v any) (driver.Value, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// With the debug_capture option the page requests of an analysis are
+// recorded, and when the analysis fails the recording is stored for admins.
+// Credential headers are redacted.
+
+// storeDebugCapture replaces the stored capture of an analysis.
+func storeDebugCapture(j queuedJob, capture *analyzer.Capture, jobErr error) error {
+	capture.Finish()
+	encoded, err := json.Marshal(capture.Exchanges)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec("REPLACE INTO debug_captures (analysis_id, job_id, error, exchanges) VALUES (?, ?, ?, ?)", j.AnalysisID, j.ID, jobErr.Error(), string(encoded))
+	return err
+}
+
+// getDebugCaptureHandler returns the capture of the last failed run of an
+// analysis. It is only served to admins.
+func getDebugCaptureHandler(c *gin.Context) {
+	var (
+		analysisID, jobID int
+		jobErr            string
+		exchanges         []byte
+		createdAt         time.Time
+	)
+	err := db.QueryRow("SELECT analysis_id, job_id, COALESCE(error, ''), exchanges, created_at FROM debug_captures WHERE analysis_id = ?", c.Param("id")).Scan(&analysisID, &jobID, &jobErr, &exchanges, &createdAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No debug capture for this analysis"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying debug capture: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query debug capture"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id": analysisID,
+		"job_id":      jobID,
+		"error":       jobErr,
+		"created_at":  createdAt,
+		"exchanges":   json.RawMessage(exchanges),
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// replaceLinkChecks replaces the link checks of an analysis, or its
+// resource checks when resource is set.
+func replaceLinkChecks(tx *sql.Tx, analysisID int, resource bool, checks []analyzer.LinkCheck) error {
+	if _, err := tx.Exec("DELETE FROM link_checks WHERE analysis_id = ? AND resource = ?", analysisID, resource); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		_, err := tx.Exec("INSERT INTO link_checks (analysis_id, url, status, error, error_class, redirect_status, final_url, redirect_decision, duration_ms, size_bytes, external, resource) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			analysisID, check.URL, check.Status, check.Error, check.ErrorClass, check.RedirectStatus, check.FinalURL, check.RedirectDecision, check.DurationMS, check.SizeBytes, check.External, resource)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadDependencies returns the external resource checks of several analyses
+// keyed by analysis ID, at most dependencyReportSize of them per analysis
+// in the given order.
+func loadDependencies(analysisIDs []int, orderBy string) (map[int][]analyzer.LinkCheck, error) {
+	dependencies := map[int][]analyzer.LinkCheck{}
+	for _, id := range analysisIDs {
+		dependencies[id] = []analyzer.LinkCheck{}
+	}
+
+	query := "SELECT analysis_id, " + linkCheckColumns + " FROM (SELECT link_checks.*, ROW_NUMBER() OVER (PARTITION BY analysis_id ORDER BY " + orderBy + ", id) AS dependency_rank FROM link_checks WHERE analysis_id IN (?) AND resource AND external) AS ranked WHERE dependency_rank <= ? ORDER BY analysis_id, dependency_rank"
+	err := queryAnalysesRows(query, analysisIDs, func(rows *sql.Rows) error {
+		var analysisID int
+		var check analyzer.LinkCheck
+		if err := rows.Scan(append([]any{&analysisID}, linkCheckTargets(&check)...)...); err != nil {
+			return err
+		}
+		dependencies[analysisID] = append(dependencies[analysisID], check)
+		return nil
+	}, analyzer.DependencyReportSize)
+	return dependencies, err
+}
+
+// loadLinkChecks returns every link check of an analysis in check order.
+func loadLinkChecks(analysisID int) ([]analyzer.LinkCheck, error) {
+	return queryLinkChecks("WHERE analysis_id = ? AND NOT resource ORDER BY id", analysisID)
+}
+
+const linkCheckColumns = "url, status, COALESCE(error, ''), COALESCE(error_class, ''), redirect_status, COALESCE(final_url, ''), COALESCE(redirect_decision, ''), duration_ms, size_bytes, external"
+
+// linkCheckTargets are the scan destinations of linkCheckColumns.
+func linkCheckTargets(l *analyzer.LinkCheck) []any {
+	return []any{&l.URL, &l.Status, &l.Error, &l.ErrorClass, &l.RedirectStatus, &l.FinalURL, &l.RedirectDecision, &l.DurationMS, &l.SizeBytes, &l.External}
+}
+
+func queryLinkChecks(clause string, args ...any) ([]analyzer.LinkCheck, error) {
+	rows, err := db.Query("SELECT "+linkCheckColumns+" FROM link_checks "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checks := []analyzer.LinkCheck{}
+	for rows.Next() {
+		var check analyzer.LinkCheck
+		if err := rows.Scan(linkCheckTargets(&check)...); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+func permanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+// remediationHint suggests what an editor should do about a link.
+func remediationHint(check analyzer.LinkCheck) string {
+	var hint string
+	switch check.ErrorClass {
+	case analyzer.ErrorClassNotFound:
+		hint = "target not found — fix the URL or remove the link"
+	case analyzer.ErrorClassGone:
+		hint = "target was removed permanently — remove the link"
+	case analyzer.ErrorClassUnauthorized:
+		hint = "target requires authorization — link to a public page instead"
+	case analyzer.ErrorClassClientError:
+		hint = fmt.Sprintf("target rejects the request with status %d — check the URL", check.Status)
+	case analyzer.ErrorClassServerError:
+		hint = "target server fails — check again later or contact the site owner"
+	case analyzer.ErrorClassTimeout:
+		hint = "target does not respond in time — check the host or remove the link"
+	case analyzer.ErrorClassDNS:
+		hint = "host name does not resolve — check the domain for typos"
+	case analyzer.ErrorClassConnectionRefused:
+		hint = "host refuses connections — check the host or remove the link"
+	case analyzer.ErrorClassTLS:
+		hint = "TLS handshake with the target fails — check the host's TLS setup"
+	case analyzer.ErrorClassTLSExpired:
+		hint = "target's TLS certificate has expired — renew it or link to a working host"
+	case analyzer.ErrorClassTLSHostnameMismatch:
+		hint = "target's TLS certificate is for another host name — check the URL or fix the certificate"
+	case analyzer.ErrorClassTLSUnknownAuthority:
+		hint = "target's TLS certificate is self-signed or from an unknown CA — add the CA bundle to the project for internal hosts"
+	case analyzer.ErrorClassTooManyRedirects:
+		hint = "target redirects too often or in a loop — fix the target or remove the link"
+	case analyzer.ErrorClassInsecureRedirect:
+		hint = "target redirects from https to http — link to a secure URL"
+	case analyzer.ErrorClassInvalidURL:
+		hint = "link is not a valid URL — fix the href"
+	case analyzer.ErrorClassBlocked:
+		hint = "target address is blocked by the target rules — remove the link or ask an admin to allow it"
+	case analyzer.ErrorClassRequestFailed:
+		hint = "request failed — check the link"
+	}
+
+	if permanentRedirect(check.RedirectStatus) {
+		redirect := "target redirects permanently — update link to " + check.FinalURL
+		if hint == "" || check.ErrorClass == analyzer.ErrorClassPermanentRedirect {
+			return redirect
+		}
+		return redirect + "; " + hint
+	}
+	return hint
+}
+
+// brokenLinkRow is a line of the broken link report.
+type brokenLinkRow struct {
+	SourcePage  string `json:"source_page"`
+	TargetURL   string `json:"target_url"`
+	Status      int    `json:"status"`
+	ErrorClass  string `json:"error_class"`
+	AnchorText  string `json:"anchor_text"`
+	Remediation string `json:"remediation"`
+}
+
+// brokenLinkReport lists the broken links of an analysis followed by the
+// links that redirect permanently, which editors should update as well.
+func brokenLinkReport(analysisID int, sourcePage string) ([]brokenLinkRow, error) {
+	broken, err := loadValues("broken_links", "link", analysisID)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := loadLinkChecks(analysisID)
+	if err != nil {
+		return nil, err
+	}
+	anchors, err := loadAnchorTexts(analysisID)
+	if err != nil {
+		return nil, err
+	}
+
+	byURL := map[string]analyzer.LinkCheck{}
+	for _, check := range checks {
+		byURL[check.URL] = check
+	}
+
+	rows := []brokenLinkRow{}
+	add := func(check analyzer.LinkCheck) {
+		rows = append(rows, brokenLinkRow{
+			SourcePage:  sourcePage,
+			TargetURL:   check.URL,
+			Status:      check.Status,
+			ErrorClass:  check.ErrorClass,
+			AnchorText:  anchors[check.URL],
+			Remediation: remediationHint(check),
+		})
+	}
+
+	seen := map[string]bool{}
+	for _, link := range broken {
+		if seen[link] {
+			continue
+		}
+		seen[link] = true
+		check, ok := byURL[link]
+		if !ok {
+			check = analyzer.LinkCheck{URL: link, ErrorClass: analyzer.ErrorClassRequestFailed}
+		}
+		add(check)
+	}
+	for _, check := range checks {
+		if !seen[check.URL] && !check.Broken() && permanentRedirect(check.RedirectStatus) {
+			seen[check.URL] = true
+			check.ErrorClass = analyzer.ErrorClassPermanentRedirect
+			add(check)
+		}
+	}
+	return rows, nil
+}
+
+// exportBrokenLinksHandler returns the broken link report as JSON or, with
+// format=csv, as a CSV download.
+func exportBrokenLinksHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or csv"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid analysis id"})
+		return
+	}
+
+	var sourcePage string
+	err = db.QueryRow("SELECT url FROM analyses WHERE id = ?", id).Scan(&sourcePage)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying analysis %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analysis"})
+		return
+	}
+
+	rows, err := brokenLinkReport(id, sourcePage)
+	if err != nil {
+		log.Printf("Error querying broken links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query broken links"})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, rows)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"analysis-%d-broken-links.csv\"", id))
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"source_page", "target_url", "status", "error_class", "anchor_text", "remediation"})
+	for _, row := range rows {
+		status := ""
+		if row.Status != 0 {
+			status = strconv.Itoa(row.Status)
+		}
+		w.Write([]string{row.SourcePage, row.TargetURL, status, row.ErrorClass, csvSafe(row.AnchorText), row.Remediation})
+	}
+	w.Flush()
+}
+
+// csvSafe keeps page controlled text from being read as a formula by
+// spreadsheet applications.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// analysisField maps a JSON field of Analysis to the SQL expression it is
+// read from. Fields without a column are loaded from other tables by load,
+// for all analyses of a query at once.
+type analysisField struct {
+	name   string
+	column string
+	target func(*Analysis) any
+	load   func([]Analysis) error
+}
+
+var analysisFields = []analysisField{
+	{"id", "id", func(a *Analysis) any { return &a.ID }, nil},
+	{"url", "url", func(a *Analysis) any { return &a.URL }, nil},
+	{"project_id", "COALESCE(project_id, 0)", func(a *Analysis) any { return &a.ProjectID }, nil},
+	{"options", "options", func(a *Analysis) any { return &a.Options }, nil},
+	{"preset", "COALESCE(preset, '')", func(a *Analysis) any { return &a.Preset }, nil},
+	{"has_credentials", "credentials IS NOT NULL", func(a *Analysis) any { return &a.HasCredentials }, nil},
+	{"html_version", "COALESCE(html_version, '')", func(a *Analysis) any { return &a.HTMLVersion }, nil},
+	{"title", "COALESCE(title, '')", func(a *Analysis) any { return &a.Title }, nil},
+	{"h1_count", "h1_count", func(a *Analysis) any { return &a.H1Count }, nil},
+	{"h2_count", "h2_count", func(a *Analysis) any { return &a.H2Count }, nil},
+	{"h3_count", "h3_count", func(a *Analysis) any { return &a.H3Count }, nil},
+	{"h4_count", "h4_count", func(a *Analysis) any { return &a.H4Count }, nil},
+	{"h5_count", "h5_count", func(a *Analysis) any { return &a.H5Count }, nil},
+	{"h6_count", "h6_count", func(a *Analysis) any { return &a.H6Count }, nil},
+	{"internal_links", "internal_links", func(a *Analysis) any { return &a.InternalLinks }, nil},
+	{"external_links", "external_links", func(a *Analysis) any { return &a.ExternalLinks }, nil},
+	{"inaccessible_links", "inaccessible_links", func(a *Analysis) any { return &a.InaccessibleLinks }, nil},
+	{"ignored_links", "ignored_links", func(a *Analysis) any { return &a.IgnoredLinks }, nil},
+	{"broken_links", "", nil, func(analyses []Analysis) error {
+		links, err := loadValuesOf("broken_links", "link", analysisIDs(analyses))
+		for i := range analyses {
+			analyses[i].BrokenLinks = links[analyses[i].ID]
+		}
+		return err
+	}},
+	{"slowest_dependencies", "", nil, func(analyses []Analysis) error {
+		slowest, err := loadDependencies(analysisIDs(analyses), "duration_ms DESC")
+		for i := range analyses {
+			analyses[i].SlowestDependencies = slowest[analyses[i].ID]
+		}
+		return err
+	}},
+	{"largest_dependencies", "", nil, func(analyses []Analysis) error {
+		largest, err := loadDependencies(analysisIDs(analyses), "size_bytes DESC")
+		for i := range analyses {
+			analyses[i].LargestDependencies = largest[analyses[i].ID]
+		}
+		return err
+	}},
+	{"has_login_form", "COALESCE(has_login_form, FALSE)", func(a *Analysis) any { return &a.HasLoginForm }, nil},
+	{"meta_robots", "COALESCE(meta_robots, '')", func(a *Analysis) any { return &a.MetaRobots }, nil},
+	{"x_robots_tag", "COALESCE(x_robots_tag, '')", func(a *Analysis) any { return &a.XRobotsTag }, nil},
+	{"noindex", "COALESCE(noindex, FALSE)", func(a *Analysis) any { return &a.NoIndex }, nil},
+	{"nofollow", "COALESCE(nofollow, FALSE)", func(a *Analysis) any { return &a.NoFollow }, nil},
+	{"indexable", "indexable", func(a *Analysis) any { return &a.Indexable }, nil},
+	{"indexability_warning", "COALESCE(indexability_warning, '')", func(a *Analysis) any { return &a.IndexabilityWarning }, nil},
+	{"seo", "seo", func(a *Analysis) any { return &a.SEO }, nil},
+	{"validation_error_count", "validation_error_count", func(a *Analysis) any { return &a.ValidationErrors }, nil},
+	{"validation_findings", "", nil, func(analyses []Analysis) error {
+		findings, err := loadValuesOf("validation_findings", "message", analysisIDs(analyses))
+		for i := range analyses {
+			analyses[i].ValidationFindings = findings[analyses[i].ID]
+		}
+		return err
+	}},
+	{"language", "COALESCE(language, '')", func(a *Analysis) any { return &a.Language }, nil},
+	{"word_count", "word_count", func(a *Analysis) any { return &a.WordCount }, nil},
+	{"skipped_checks", "skipped_checks", func(a *Analysis) any { return &a.SkippedChecks }, nil},
+	{"etag", "COALESCE(etag, '')", func(a *Analysis) any { return &a.ETag }, nil},
+	{"last_modified", "COALESCE(last_modified, '')", func(a *Analysis) any { return &a.LastModified }, nil},
+	{"redirects", "redirects", func(a *Analysis) any { return &a.Redirects }, nil},
+	{"status", "status", func(a *Analysis) any { return &a.Status }, nil},
+	{"created_at", "created_at", func(a *Analysis) any { return &a.CreatedAt }, nil},
+	{"updated_at", "updated_at", func(a *Analysis) any { return &a.UpdatedAt }, nil},
+	{"finished_at", "finished_at", func(a *Analysis) any { return &a.FinishedAt }, nil},
+}
+
+// parseFieldsParam resolves the comma separated fields query parameter. An
+// empty parameter selects every field.
+func parseFieldsParam(param string) ([]analysisField, error) {
+	if strings.TrimSpace(param) == "" {
+		return analysisFields, nil
+	}
+
+	var fields []analysisField
+	seen := map[string]bool{}
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+
+		field, ok := lookupAnalysisField(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		seen[name] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+func lookupAnalysisField(name string) (analysisField, bool) {
+	for _, field := range analysisFields {
+		if field.name == name {
+			return field, true
+		}
+	}
+	return analysisField{}, false
+}
+
+// withAnalysisField returns fields with the named field added if missing.
+func withAnalysisField(fields []analysisField, name string) []analysisField {
+	for _, field := range fields {
+		if field.name == name {
+			return fields
+		}
+	}
+	field, _ := lookupAnalysisField(name)
+	return append(fields[:len(fields):len(fields)], field)
+}
+
+// queryAnalyses selects only the columns needed for fields. The id is always
+// read because related rows are looked up by it.
+func queryAnalyses(fields []analysisField, clause string, args ...any) ([]Analysis, error) {
+	columns := []string{"id"}
+	for _, field := range fields {
+		if field.column != "" && field.name != "id" {
+			columns = append(columns, field.column)
+		}
+	}
+
+	rows, err := db.Query("SELECT "+strings.Join(columns, ", ")+" FROM analyses "+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var analyses []Analysis
+	for rows.Next() {
+		var analysis Analysis
+		targets := []any{&analysis.ID}
+		for _, field := range fields {
+			if field.column != "" && field.name != "id" {
+				targets = append(targets, field.target(&analysis))
+			}
+		}
+
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		analyses = append(analyses, analysis)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		if field.load == nil || len(analyses) == 0 {
+			continue
+		}
+		if err := field.load(analyses); err != nil {
+			return nil, err
+		}
+	}
+
+	return analyses, nil
+}
+
+func analysisIDs(analyses []Analysis) []int {
+	ids := make([]int, len(analyses))
+	for i, analysis := range analyses {
+		ids[i] = analysis.ID
+	}
+	return ids
+}
+
+// sparseAnalysis limits the JSON representation of an analysis to fields.
+func sparseAnalysis(analysis Analysis, fields []analysisField) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(analysis)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, field := range fields {
+		out[field.name] = all[field.name]
+	}
+	return out, nil
+}
+
+// analysesResponse returns analyses as is when no fields were requested and
+// their sparse representation otherwise.
+func analysesResponse(analyses []Analysis, fields []analysisField, sparse bool) (any, error) {
+	if !sparse {
+		return analyses, nil
+	}
+
+	out := make([]map[string]json.RawMessage, 0, len(analyses))
+	for _, analysis := range analyses {
+		item, err := sparseAnalysis(analysis, fields)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
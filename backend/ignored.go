@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IgnoredLink is a broken link acknowledged for a project. Later runs of
+// the project's analyses leave it out of their broken links and count it
+// in ignored_links instead.
+type IgnoredLink struct {
+	ID        int       `json:"id"`
+	ProjectID int       `json:"project_id"`
+	Link      string    `json:"link"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func loadIgnoredLinks(projectID int) ([]IgnoredLink, error) {
+	rows, err := db.Query("SELECT id, project_id, link, COALESCE(reason, ''), created_at FROM ignored_links WHERE project_id = ? ORDER BY id", projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []IgnoredLink{}
+	for rows.Next() {
+		var l IgnoredLink
+		if err := rows.Scan(&l.ID, &l.ProjectID, &l.Link, &l.Reason, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// applyIgnoredLinks removes the links acknowledged for the project from
+// brokenLinks and returns the remaining links and how many were removed.
+func applyIgnoredLinks(projectID int, brokenLinks []string) ([]string, int, error) {
+	if projectID == 0 || len(brokenLinks) == 0 {
+		return brokenLinks, 0, nil
+	}
+
+	ignored, err := loadIgnoredLinks(projectID)
+	if err != nil {
+		return nil, 0, err
+	}
+	skip := map[string]bool{}
+	for _, l := range ignored {
+		skip[l.Link] = true
+	}
+
+	var kept []string
+	for _, link := range brokenLinks {
+		if !skip[link] {
+			kept = append(kept, link)
+		}
+	}
+	return kept, len(brokenLinks) - len(kept), nil
+}
+
+func getIgnoredLinksHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	links, err := loadIgnoredLinks(project.ID)
+	if err != nil {
+		log.Printf("Error querying ignored links: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query ignored links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, links)
+}
+
+// ignoreLinkHandler acknowledges a broken link. Acknowledging a link again
+// updates its reason.
+func ignoreLinkHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Link   string `json:"link" binding:"required,max=2048"`
+		Reason string `json:"reason" binding:"max=1000"`
+	}
+	if !bindBody(c, &body) {
+		return
+	}
+
+	var id int
+	err := db.QueryRow("SELECT id FROM ignored_links WHERE project_id = ? AND link = ?", project.ID, body.Link).Scan(&id)
+	status := http.StatusOK
+	switch {
+	case err == sql.ErrNoRows:
+		result, err := db.Exec("INSERT INTO ignored_links (project_id, link, reason) VALUES (?, ?, ?)", project.ID, body.Link, body.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		lastID, _ := result.LastInsertId()
+		id, status = int(lastID), http.StatusCreated
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	default:
+		if _, err := db.Exec("UPDATE ignored_links SET reason = ? WHERE id = ?", body.Reason, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var link IgnoredLink
+	err = db.QueryRow("SELECT id, project_id, link, COALESCE(reason, ''), created_at FROM ignored_links WHERE id = ?", id).Scan(&link.ID, &link.ProjectID, &link.Link, &link.Reason, &link.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(status, link)
+}
+
+func deleteIgnoredLinkHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM ignored_links WHERE id = ? AND project_id = ?", c.Param("linkId"), project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ignored link not found"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// Job kinds picked up by the worker. A full job downloads and parses the
+// page; a links job only re-verifies the link set stored by the last full
+// run.
+const (
+	jobKindFull  = "full"
+	jobKindLinks = "links"
+)
+
+// Job is a single queued run of an analysis. Every submission, rerun and
+// recheck creates a new job so clients can poll it until it finishes.
+type Job struct {
+	ID         int        `json:"id"`
+	AnalysisID int        `json:"analysis_id"`
+	Kind       string     `json:"kind"`
+	State      string     `json:"state"`
+	Priority   int        `json:"priority"`
+	Progress   int        `json:"progress"`
+	Unchanged  bool       `json:"unchanged"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	Self       string     `json:"self"`
+	Result     string     `json:"result,omitempty"`
+}
+
+var (
+	errAnalysisNotFound = errors.New("analysis not found")
+	errJobActive        = errors.New("analysis already has a queued or running job")
+	errJobStopped       = errors.New("job was stopped")
+)
+
+// A worker holds a lease on the jobs it runs and renews it while they run.
+// Jobs whose lease expired were left by a worker that is gone and are
+// queued again.
+const (
+	jobLease          = 2 * time.Minute
+	jobLeaseHeartbeat = 30 * time.Second
+)
+
+// workerID identifies this process in the jobs it claims.
+var workerID = newWorkerID()
+
+func newWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%.40s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+func jobLocation(id int) string {
+	return fmt.Sprintf("/api/jobs/%d", id)
+}
+
+// enqueueJob queues a new job of owner for an analysis and marks the
+// analysis as queued. Jobs with a higher priority are started first. The
+// job counts towards the daily quotas of owner and of the analysis'
+// project; a *quotaError is returned when it goes over one.
+//
+// An analysis has at most one queued or running job. The analysis row
+// stays locked until tx ends so concurrent submissions are checked one
+// after the other; when a job is active already its ID is returned with
+// errJobActive.
+func enqueueJob(tx *sql.Tx, analysisID int, kind string, priority int, owner string) (int, error) {
+	var projectID int
+	var quotas quotaLimits
+	err := tx.QueryRow("SELECT COALESCE(analyses.project_id, 0), projects.quotas FROM analyses LEFT JOIN projects ON projects.id = analyses.project_id WHERE analyses.id = ? FOR UPDATE OF analyses", analysisID).Scan(&projectID, &quotas)
+	if err == sql.ErrNoRows {
+		return 0, errAnalysisNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var activeID int
+	err = tx.QueryRow("SELECT id FROM jobs WHERE analysis_id = ? AND state IN (?, ?) ORDER BY id LIMIT 1", analysisID, "queued", "running").Scan(&activeID)
+	if err == nil {
+		return activeID, errJobActive
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	if err := countSubmission(tx, quotaScopeUser, owner, userQuotas().MaxAnalysesPerDay); err != nil {
+		return 0, err
+	}
+	if projectID != 0 {
+		if err := countSubmission(tx, quotaScopeProject, strconv.Itoa(projectID), quotas.MaxAnalysesPerDay); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := setAnalysisStatus(tx, analysisID, "queued"); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO jobs (analysis_id, kind, state, priority, owner) VALUES (?, ?, ?, ?, ?)", analysisID, kind, "queued", priority, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// submitJob enqueues a job in its own transaction and answers with the job
+// resource.
+func submitJob(c *gin.Context, analysisID int, kind string) {
+	if rejectWhileDraining(c) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobID, err := enqueueJob(tx, analysisID, kind, 0, currentUser(c))
+	if err == errAnalysisNotFound {
+		tx.Rollback()
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if err == errJobActive {
+		tx.Rollback()
+		respondJobActive(c, jobID)
+		return
+	}
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		tx.Rollback()
+		respondQuotaExceeded(c, quotaErr)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	respondJobAccepted(c, jobID)
+}
+
+// respondJobAccepted answers 202 with the job resource and its Location.
+func respondJobAccepted(c *gin.Context, jobID int) {
+	job, err := loadJob(jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", job.Self)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// respondJobActive answers 409 with the job already queued or running for
+// the analysis.
+func respondJobActive(c *gin.Context, jobID int) {
+	job, err := loadJob(jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Location", job.Self)
+	c.JSON(http.StatusConflict, gin.H{"error": "Analysis already has a queued or running job", "job": job})
+}
+
+func loadJob(id int) (*Job, error) {
+	var job Job
+	var errMsg sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := db.QueryRow("SELECT id, analysis_id, kind, state, priority, progress, unchanged, error, created_at, started_at, finished_at FROM jobs WHERE id = ?", id).Scan(
+		&job.ID, &job.AnalysisID, &job.Kind, &job.State, &job.Priority, &job.Progress, &job.Unchanged, &errMsg, &job.CreatedAt, &startedAt, &finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Error = errMsg.String
+	job.CreatedAt = job.CreatedAt.UTC()
+	if startedAt.Valid {
+		t := startedAt.Time.UTC()
+		job.StartedAt = &t
+	}
+	if finishedAt.Valid {
+		t := finishedAt.Time.UTC()
+		job.FinishedAt = &t
+	}
+
+	job.Self = jobLocation(job.ID)
+	if job.State == "done" {
+		job.Result = fmt.Sprintf("/api/analyses/%d", job.AnalysisID)
+	}
+	return &job, nil
+}
+
+func getJobHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job id"})
+		return
+	}
+
+	job, err := loadJob(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying job %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query job"})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// loadQueuedJobs lists queued jobs in the order they should start, with
+// project defaults and analysis overrides already merged into their options.
+func loadQueuedJobs() ([]queuedJob, error) {
+	rows, err := db.Query("SELECT jobs.id, jobs.analysis_id, jobs.kind, COALESCE(jobs.owner, ''), COALESCE(analyses.project_id, 0), analyses.url, COALESCE(analyses.etag, ''), COALESCE(analyses.last_modified, ''), projects.settings, projects.quotas, analyses.options, projects.credentials, analyses.credentials FROM jobs JOIN analyses ON analyses.id = jobs.analysis_id LEFT JOIN projects ON projects.id = analyses.project_id WHERE jobs.state = ? ORDER BY jobs.priority DESC, jobs.id", "queued")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []queuedJob
+	for rows.Next() {
+		var j queuedJob
+		var projectSettings, overrides analyzer.Options
+		var projectCredentials, credentials sql.NullString
+		err := rows.Scan(&j.ID, &j.AnalysisID, &j.Kind, &j.Owner, &j.ProjectID, &j.URL, &j.ETag, &j.LastModified, &projectSettings, &j.Quotas, &overrides, &projectCredentials, &credentials)
+		if err != nil {
+			return nil, err
+		}
+		j.Options = projectSettings.Merge(overrides)
+
+		merged, err := mergeStoredCredentials(j.ProjectID, projectCredentials, j.AnalysisID, credentials)
+		if err != nil {
+			log.Println("Worker error:", err)
+			finishJob(j, "error", err)
+			continue
+		}
+		j.Options.Credentials = analyzer.Credentials(merged)
+
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// recoverOrphanedJobs queues the running jobs whose lease expired again.
+// The worker that claimed them is gone, yet they would keep counting
+// towards the concurrency limits. Jobs of live workers are left alone.
+func recoverOrphanedJobs() error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const expired = "state = 'running' AND (lease_expires_at IS NULL OR lease_expires_at < CURRENT_TIMESTAMP)"
+
+	_, err = tx.Exec("UPDATE analyses SET status = ?, updated_at = CURRENT_TIMESTAMP, finished_at = NULL WHERE id IN (SELECT analysis_id FROM jobs WHERE "+expired+")", "queued")
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE jobs SET state = ?, progress = 0, started_at = NULL, worker_id = NULL, lease_expires_at = NULL WHERE "+expired, "queued")
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if recovered, _ := result.RowsAffected(); recovered > 0 {
+		log.Printf("Requeued %d jobs left running", recovered)
+	}
+	return nil
+}
+
+// runningAnalyses returns the IDs of the analyses with a running job.
+func runningAnalyses() (map[int]bool, error) {
+	rows, err := db.Query("SELECT DISTINCT analysis_id FROM jobs WHERE state = ?", "running")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	running := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		running[id] = true
+	}
+	return running, rows.Err()
+}
+
+// claimJob atomically moves a queued job to running under a lease of this
+// worker, together with its analysis. It returns false when the job is no
+// longer queued, so a job is never processed twice.
+func claimJob(j queuedJob) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE jobs SET state = ?, progress = 0, started_at = CURRENT_TIMESTAMP, worker_id = ?, lease_expires_at = CURRENT_TIMESTAMP + INTERVAL ? SECOND WHERE id = ? AND state = ?", "running", workerID, int(jobLease.Seconds()), j.ID, "queued")
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	if err := setAnalysisStatus(tx, j.AnalysisID, "running"); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// renewLease extends the lease of a running job every jobLeaseHeartbeat
+// until the returned function is called.
+func renewLease(j queuedJob) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(jobLeaseHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				_, err := db.Exec("UPDATE jobs SET lease_expires_at = CURRENT_TIMESTAMP + INTERVAL ? SECOND WHERE id = ? AND worker_id = ? AND state = ?", int(jobLease.Seconds()), j.ID, workerID, "running")
+				if err != nil {
+					log.Println("Worker error:", err)
+				}
+			}
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// finishJob records that a job ended without results, in state "error"
+// or "stopped". A job stopped meanwhile stays stopped.
+func finishJob(j queuedJob, state string, jobErr error) {
+	var errMsg sql.NullString
+	if jobErr != nil {
+		errMsg = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+
+	result, err := db.Exec("UPDATE jobs SET state = ?, error = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ? AND state <> ?", state, errMsg, j.ID, "stopped")
+	if err != nil {
+		log.Println("Worker error:", err)
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return
+	}
+
+	if err := setAnalysisStatus(db, j.AnalysisID, state); err != nil {
+		log.Println("Worker error:", err)
+	}
+}
+
+// completeJob marks a running job and its analysis done in tx, the
+// transaction that stores the results. It returns errJobStopped when the
+// job or the analysis was stopped meanwhile, or when the job was requeued
+// after this worker lost its lease, so the results of a run never
+// overwrite a stop.
+func completeJob(tx *sql.Tx, j queuedJob, unchanged bool) error {
+	result, err := tx.Exec("UPDATE jobs SET state = ?, progress = 100, unchanged = ?, finished_at = CURRENT_TIMESTAMP WHERE id = ? AND state = ? AND worker_id = ?", "done", unchanged, j.ID, "running", workerID)
+	if err = stoppedUnlessChanged(result, err); err != nil {
+		return err
+	}
+
+	result, err = tx.Exec("UPDATE analyses SET status = ?, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP WHERE id = ? AND status <> ?", "done", j.AnalysisID, "stopped")
+	return stoppedUnlessChanged(result, err)
+}
+
+func stoppedUnlessChanged(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errJobStopped
+	}
+	return nil
+}
+
+// finishUnchangedJob records a run that found the page not modified since
+// the previous run. The stored results stay as they are.
+func finishUnchangedJob(j queuedJob) {
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	err = completeJob(tx, j, true)
+	if err == errJobStopped {
+		tx.Rollback()
+		finishJob(j, "stopped", nil)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+	}
+}
+
+// jobProgress returns a callback that stores link check progress of a job,
+// writing only when the percentage changes. offset is the share of the job
+// already spent fetching and parsing the page.
+func jobProgress(jobID int, offset int) func(done, total int) {
+	last := -1
+	return func(done, total int) {
+		if total == 0 {
+			return
+		}
+		percent := offset + done*(100-offset)/total
+		if percent >= 100 {
+			percent = 99
+		}
+		if percent == last {
+			return
+		}
+		last = percent
+		if _, err := db.Exec("UPDATE jobs SET progress = ? WHERE id = ?", percent, jobID); err != nil {
+			log.Println("Worker error:", err)
+		}
+	}
+}
+
+// queuedJob is what the worker needs to run a job.
+type queuedJob struct {
+	ID           int
+	AnalysisID   int
+	Kind         string
+	Owner        string
+	ProjectID    int
+	Quotas       quotaLimits
+	URL          string
+	ETag         string
+	LastModified string
+	Options      analyzer.Options
+}
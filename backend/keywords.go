@@ -0,0 +1,83 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+func replaceKeywords(tx *sql.Tx, analysisID int, words, bigrams []analyzer.Keyword) error {
+	if _, err := tx.Exec("DELETE FROM keywords WHERE analysis_id = ?", analysisID); err != nil {
+		return err
+	}
+	for kind, keywords := range map[string][]analyzer.Keyword{"word": words, "bigram": bigrams} {
+		for _, k := range keywords {
+			if _, err := tx.Exec("INSERT INTO keywords (analysis_id, kind, term, count) VALUES (?, ?, ?, ?)", analysisID, kind, k.Term, k.Count); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func loadKeywords(analysisID int, kind string, wordCount int) ([]analyzer.Keyword, error) {
+	rows, err := db.Query("SELECT term, count FROM keywords WHERE analysis_id = ? AND kind = ? ORDER BY count DESC, term", analysisID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keywords := []analyzer.Keyword{}
+	for rows.Next() {
+		var k analyzer.Keyword
+		if err := rows.Scan(&k.Term, &k.Count); err != nil {
+			return nil, err
+		}
+		k.Density = analyzer.KeywordDensity(k.Count, wordCount)
+		keywords = append(keywords, k)
+	}
+	return keywords, rows.Err()
+}
+
+// getKeywordsHandler returns the keyword frequency report of an analysis.
+func getKeywordsHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	var analysisID, wordCount int
+	var language string
+	err := db.QueryRow("SELECT id, COALESCE(language, ''), word_count FROM analyses WHERE id = ?", id).Scan(&analysisID, &language, &wordCount)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying analysis %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analysis"})
+		return
+	}
+
+	words, err := loadKeywords(analysisID, "word", wordCount)
+	if err != nil {
+		log.Printf("Error querying keywords: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query keywords"})
+		return
+	}
+	bigrams, err := loadKeywords(analysisID, "bigram", wordCount)
+	if err != nil {
+		log.Printf("Error querying keywords: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query keywords"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id": analysisID,
+		"language":    language,
+		"word_count":  wordCount,
+		"keywords":    words,
+		"bigrams":     bigrams,
+	})
+}
@@ -1,40 +1,36 @@
 package main
 
 import (
+	"crypto/subtle"
 	"database/sql"
+	_ "embed"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
-	"golang.org/x/net/html"
+
+	"challenge-sykell/backend/analyzer"
 )
 
 var db *sql.DB
 
 type Analysis struct {
-	ID                int      `json:"id"`
-	URL               string   `json:"url"`
-	HTMLVersion       string   `json:"html_version"`
-	Title             string   `json:"title"`
-	H1Count           int      `json:"h1_count"`
-	H2Count           int      `json:"h2_count"`
-	H3Count           int      `json:"h3_count"`
-	H4Count           int      `json:"h4_count"`
-	H5Count           int      `json:"h5_count"`
-	H6Count           int      `json:"h6_count"`
-	InternalLinks     int      `json:"internal_links"`
-	ExternalLinks     int      `json:"external_links"`
-	InaccessibleLinks int      `json:"inaccessible_links"`
-	BrokenLinks       []string `json:"broken_links"`
-	HasLoginForm      bool     `json:"has_login_form"`
-	Status            string   `json:"status"`
+	ID int `json:"id"`
+	analyzer.Result
+	ProjectID      int        `json:"project_id,omitempty"`
+	Preset         string     `json:"preset"`
+	HasCredentials bool       `json:"has_credentials"`
+	IgnoredLinks   int        `json:"ignored_links"`
+	Status         string     `json:"status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
 }
 
 func getEnvWithDefault(key, defaultValue string) string {
@@ -53,7 +49,8 @@ func main() {
 	dbName := getEnvWithDefault("DB_NAME", "webtraffic")
 
 	var err error
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPass, dbHost, dbPort, dbName)
+	// Timestamps are read and written in UTC so the API can report them as is
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&loc=UTC&time_zone=%%27%%2B00%%3A00%%27", dbUser, dbPass, dbHost, dbPort, dbName)
 	
 	// Retry database connection
 	for i := 0; i < 30; i++ {
@@ -79,6 +76,11 @@ func main() {
 	}
 
 	createTable()
+	registerValidators()
+
+	if err := recoverOrphanedJobs(); err != nil {
+		log.Fatal("Failed to recover jobs:", err)
+	}
 
 	go startWorker()
 
@@ -89,6 +91,7 @@ func main() {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Expose-Headers", "Location, Link, X-Next-Cursor, X-Prev-Cursor")
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -98,15 +101,55 @@ func main() {
 		c.Next()
 	})
 
+	// Webhooks authenticate with their project's token instead.
+	r.POST("/api/hooks/projects/:id/reanalyze", reanalyzeProjectHandler)
+
 	api := r.Group("/api")
 	api.Use(authMiddleware())
 	{
 		api.POST("/analyze", analyzeHandler)
 		api.POST("/analyze/rerun", rerunHandler)
+		api.POST("/analyze/recheck-links", recheckLinksHandler)
+		api.POST("/analyze/preview", previewHandler)
 		api.POST("/analyze/start", startAnalysisHandler)
 		api.POST("/analyze/stop", stopAnalysisHandler)
 		api.GET("/analyses", getAnalysesHandler)
+		api.GET("/analyses/:id", getAnalysisHandler)
 		api.DELETE("/analyses/:id", deleteAnalysisHandler)
+		api.GET("/analyses/:id/keywords", getKeywordsHandler)
+		api.GET("/analyses/:id/outline", getOutlineHandler)
+		api.GET("/analyses/:id/broken-links/export", exportBrokenLinksHandler)
+		api.GET("/analyses/:id/debug", adminMiddleware(), getDebugCaptureHandler)
+		api.GET("/jobs/:id", getJobHandler)
+		api.GET("/usage", getUsageHandler)
+		api.POST("/projects", createProjectHandler)
+		api.GET("/projects", getProjectsHandler)
+		api.GET("/projects/:id", getProjectHandler)
+		api.PUT("/projects/:id", updateProjectHandler)
+		api.DELETE("/projects/:id", deleteProjectHandler)
+		api.GET("/projects/:id/ignored-links", getIgnoredLinksHandler)
+		api.POST("/projects/:id/ignored-links", ignoreLinkHandler)
+		api.DELETE("/projects/:id/ignored-links/:linkId", deleteIgnoredLinkHandler)
+		api.GET("/projects/:id/usage", getProjectUsageHandler)
+		api.POST("/projects/:id/webhook", createWebhookHandler)
+		api.DELETE("/projects/:id/webhook", deleteWebhookHandler)
+		api.POST("/presets", createPresetHandler)
+		api.GET("/presets", getPresetsHandler)
+		api.GET("/presets/:id", getPresetHandler)
+		api.PUT("/presets/:id", updatePresetHandler)
+		api.DELETE("/presets/:id", deletePresetHandler)
+
+		admin := api.Group("/admin")
+		admin.Use(adminMiddleware())
+		admin.GET("/queue", queueStatusHandler)
+		admin.POST("/queue/pause", pauseQueueHandler)
+		admin.POST("/queue/resume", resumeQueueHandler)
+		admin.POST("/queue/drain", drainQueueHandler)
+		admin.POST("/queue/stop-all", stopAllHandler)
+		admin.POST("/secrets/rotate", rotateSecretsHandler)
+		admin.GET("/targets", getTargetRulesHandler)
+		admin.POST("/targets", createTargetRuleHandler)
+		admin.DELETE("/targets/:id", deleteTargetRuleHandler)
 	}
 
 	port := getEnvWithDefault("PORT", "8080")
@@ -114,42 +157,14 @@ func main() {
 	r.Run(":" + port)
 }
 
+// schema is the canonical database schema. It is embedded so the binary
+// does not depend on its working directory.
+//
+//go:embed schema.sql
+var schema string
+
 func createTable() {
-	// Try to read schema.sql, if it doesn't exist, use embedded schema
-	var queries []string
-	if schemaBytes, err := ioutil.ReadFile("schema.sql"); err == nil {
-		// Split the schema into separate queries
-		queryStr := string(schemaBytes)
-		queries = strings.Split(queryStr, ";")
-	} else {
-		// Embedded schema as fallback - separate queries
-		queries = []string{
-			`CREATE TABLE IF NOT EXISTS analyses (
-				id INT AUTO_INCREMENT PRIMARY KEY,
-				url VARCHAR(255) NOT NULL,
-				html_version VARCHAR(255),
-				title VARCHAR(255),
-				h1_count INT DEFAULT 0,
-				h2_count INT DEFAULT 0,
-				h3_count INT DEFAULT 0,
-				h4_count INT DEFAULT 0,
-				h5_count INT DEFAULT 0,
-				h6_count INT DEFAULT 0,
-				internal_links INT DEFAULT 0,
-				external_links INT DEFAULT 0,
-				inaccessible_links INT DEFAULT 0,
-				has_login_form BOOLEAN,
-				status VARCHAR(255) NOT NULL,
-				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-			)`,
-			`CREATE TABLE IF NOT EXISTS broken_links (
-				id INT AUTO_INCREMENT PRIMARY KEY,
-				analysis_id INT,
-				link TEXT,
-				FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
-			)`,
-		}
-	}
+	queries := strings.Split(schema, ";")
 
 	// Execute each query separately
 	for _, query := range queries {
@@ -164,6 +179,10 @@ func createTable() {
 		}
 	}
 	
+	if err := migrate(); err != nil {
+		log.Fatal("Failed to migrate tables:", err)
+	}
+	
 	log.Println("Database tables created successfully")
 }
 
@@ -186,150 +205,264 @@ func authMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		c.Set(userContextKey, userID(parts[1]))
 		c.Next()
 	}
 }
 
+// adminMiddleware only lets through requests whose bearer token matches
+// ADMIN_TOKEN. The admin API is disabled when ADMIN_TOKEN is not set.
+func adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := os.Getenv("ADMIN_TOKEN")
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin API is disabled"})
+			return
+		}
+
+		if !isAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin token required"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// isAdmin reports whether the bearer token of the request is ADMIN_TOKEN.
+func isAdmin(c *gin.Context) bool {
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		return false
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1
+}
+
 func analyzeHandler(c *gin.Context) {
 	var body struct {
-		URL string `json:"url"`
+		URL         string           `json:"url" binding:"required,max=2048,httpurl"`
+		Priority    int              `json:"priority" binding:"min=-100,max=100"`
+		ProjectID   int              `json:"project_id" binding:"min=0"`
+		Preset      string           `json:"preset" binding:"max=255"`
+		Options     analyzer.Options `json:"options"`
+		Credentials crawlCredentials `json:"credentials"`
+	}
+	if !bindBody(c, &body) {
+		return
 	}
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+
+	// Jobs with a higher priority jump the queue, so only admins may set it.
+	if body.Priority != 0 && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin token required to set priority"})
+		return
+	}
+
+	if !credentialsStorable(c, body.Credentials) || !targetAllowed(c, body.URL) {
 		return
 	}
 
-	result, err := db.Exec("INSERT INTO analyses (url, status) VALUES (?, ?)", body.URL, "queued")
+	// The preset is resolved now, so later edits of it leave queued and
+	// finished analyses alone.
+	options, ok := resolvePreset(c, body.Preset, body.Options)
+	if !ok {
+		return
+	}
+
+	if body.ProjectID != 0 {
+		if _, err := loadProject(body.ProjectID); err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Project not found"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if rejectWhileDraining(c) {
+		return
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	id, _ := result.LastInsertId()
+	result, err := tx.Exec("INSERT INTO analyses (url, project_id, options, preset, status) VALUES (?, ?, ?, ?, ?)", body.URL, nullableID(body.ProjectID), options, body.Preset, "queued")
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"id": id})
-}
+	id, _ := result.LastInsertId()
+	if !body.Credentials.empty() {
+		if err := storeCredentials(tx, "analyses", int(id), body.Credentials); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
-func rerunHandler(c *gin.Context) {
-	var body struct {
-		ID int `json:"id"`
+	jobID, err := enqueueJob(tx, int(id), jobKindFull, body.Priority, currentUser(c))
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		tx.Rollback()
+		respondQuotaExceeded(c, quotaErr)
+		return
 	}
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err := db.Exec("UPDATE analyses SET status = ? WHERE id = ?", "queued", body.ID)
+	respondAnalysisAccepted(c, int(id), jobID)
+}
+
+// respondAnalysisAccepted answers 202 for a new analysis. id stays the
+// analysis id it was before submissions became jobs; the job is added
+// next to it.
+func respondAnalysisAccepted(c *gin.Context, analysisID, jobID int) {
+	job, err := loadJob(jobID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Status(http.StatusOK)
+	c.Header("Location", job.Self)
+	c.JSON(http.StatusAccepted, gin.H{"id": analysisID, "job_id": job.ID, "job": job})
 }
 
-func startAnalysisHandler(c *gin.Context) {
+func rerunHandler(c *gin.Context) {
 	var body struct {
-		ID int `json:"id"`
+		ID int `json:"id" binding:"required,min=1"`
 	}
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	if !bindBody(c, &body) {
 		return
 	}
 
-	_, err := db.Exec("UPDATE analyses SET status = ? WHERE id = ?", "queued", body.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	submitJob(c, body.ID, jobKindFull)
+}
+
+func startAnalysisHandler(c *gin.Context) {
+	var body struct {
+		ID int `json:"id" binding:"required,min=1"`
+	}
+	if !bindBody(c, &body) {
 		return
 	}
 
-	c.Status(http.StatusOK)
+	submitJob(c, body.ID, jobKindFull)
 }
 
 func stopAnalysisHandler(c *gin.Context) {
 	var body struct {
-		ID int `json:"id"`
+		ID int `json:"id" binding:"required,min=1"`
+	}
+	if !bindBody(c, &body) {
+		return
 	}
-	if err := c.BindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+
+	err := setAnalysisStatus(db, body.ID, "stopped")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	_, err := db.Exec("UPDATE analyses SET status = ? WHERE id = ?", "stopped", body.ID)
+	_, err = db.Exec("UPDATE jobs SET state = ?, finished_at = CURRENT_TIMESTAMP WHERE analysis_id = ? AND state IN (?, ?)", "stopped", body.ID, "queued", "running")
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	queue.cancelAnalysis(body.ID)
+
 	c.Status(http.StatusOK)
 }
 
 func getAnalysesHandler(c *gin.Context) {
-    rows, err := db.Query("SELECT id, url, html_version, title, h1_count, h2_count, h3_count, h4_count, h5_count, h6_count, internal_links, external_links, inaccessible_links, has_login_form, status FROM analyses ORDER BY created_at DESC")
-    if err != nil {
-        log.Printf("Error querying analyses: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analyses"})
-        return
-    }
-    defer rows.Close()
-
-    var analyses []Analysis
-    for rows.Next() {
-        var analysis Analysis
-        var htmlVersion, title sql.NullString
-        var hasLoginForm sql.NullBool 
-
-        err := rows.Scan(
-            &analysis.ID, &analysis.URL, &htmlVersion, &title, 
-            &analysis.H1Count, &analysis.H2Count, &analysis.H3Count, &analysis.H4Count, &analysis.H5Count, &analysis.H6Count, 
-            &analysis.InternalLinks, &analysis.ExternalLinks, &analysis.InaccessibleLinks, 
-            &hasLoginForm, 
-            &analysis.Status,
-        )
-        
-        if err != nil {
-            log.Printf("Error scanning analysis row: %v", err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan analysis row"})
-            return
-        }
-
-        analysis.HTMLVersion = htmlVersion.String
-        analysis.Title = title.String
-        analysis.HasLoginForm = hasLoginForm.Bool 
-
-        brokenLinksRows, err := db.Query("SELECT link FROM broken_links WHERE analysis_id = ?", analysis.ID)
-        if err != nil {
-            log.Printf("Error querying broken links for analysis ID %d: %v", analysis.ID, err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query broken links"})
-            return
-        }
-
-        var brokenLinks []string
-        for brokenLinksRows.Next() {
-            var link string
-            if err := brokenLinksRows.Scan(&link); err != nil {
-                log.Printf("Error scanning broken link: %v", err)
-                brokenLinksRows.Close() // Ważne: zamknij przed return
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan broken link"})
-                return
-            }
-            brokenLinks = append(brokenLinks, link)
-        }
-        brokenLinksRows.Close() 
-        
-        analysis.BrokenLinks = brokenLinks
-        analyses = append(analyses, analysis)
-    }
-
-    if err = rows.Err(); err != nil {
-        log.Printf("Error after iterating analysis rows: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error iterating analysis results"})
-        return
-    }
-
-    c.JSON(http.StatusOK, analyses)
+	fields, err := parseFieldsParam(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	selected, clause, args := fields, "ORDER BY created_at DESC, id DESC", []any(nil)
+	if page != nil {
+		// Cursors are built from created_at, so it is read even when the
+		// requested fields leave it out.
+		selected = withAnalysisField(fields, "created_at")
+		clause, args = page.clause()
+	}
+
+	analyses, err := queryAnalyses(selected, clause, args...)
+	if err != nil {
+		log.Printf("Error querying analyses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analyses"})
+		return
+	}
+
+	if page != nil {
+		var prev, next string
+		analyses, prev, next = page.trim(analyses)
+		setPageHeaders(c, page.limit, prev, next)
+	}
+
+	response, err := analysesResponse(analyses, fields, c.Query("fields") != "")
+	if err != nil {
+		log.Printf("Error encoding analyses: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode analyses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
+func getAnalysisHandler(c *gin.Context) {
+	fields, err := parseFieldsParam(c.Query("fields"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	analyses, err := queryAnalyses(fields, "WHERE id = ?", c.Param("id"))
+	if err != nil {
+		log.Printf("Error querying analysis %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analysis"})
+		return
+	}
+	if len(analyses) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+
+	if c.Query("fields") == "" {
+		c.JSON(http.StatusOK, analyses[0])
+		return
+	}
+
+	response, err := sparseAnalysis(analyses[0], fields)
+	if err != nil {
+		log.Printf("Error encoding analysis %s: %v", c.Param("id"), err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode analysis"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
 
 func deleteAnalysisHandler(c *gin.Context) {
 	id := c.Param("id")
@@ -344,241 +477,214 @@ func deleteAnalysisHandler(c *gin.Context) {
 
 func startWorker() {
 	for {
-		rows, err := db.Query("SELECT id, url FROM analyses WHERE status = ?", "queued")
+		if queue.intakeStopped() {
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		if err := recoverOrphanedJobs(); err != nil {
+			log.Println("Worker error:", err)
+		}
+
+		jobs, err := loadQueuedJobs()
+		if err != nil {
+			log.Println("Worker error:", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		running, err := runningAnalyses()
 		if err != nil {
 			log.Println("Worker error:", err)
 			time.Sleep(10 * time.Second)
 			continue
 		}
 
-		for rows.Next() {
-			var id int
-			var url string
-			err := rows.Scan(&id, &url)
+		for _, j := range jobs {
+			// Jobs of the same analysis would overwrite each other's
+			// results, so they run one after the other.
+			if running[j.AnalysisID] {
+				continue
+			}
+
+			allowed, err := startAllowed(j)
 			if err != nil {
 				log.Println("Worker error:", err)
+			}
+			if !allowed {
+				continue
+			}
+
+			if !queue.acquireSlot() {
+				break
+			}
+
+			// Another worker may have claimed or stopped the job since it
+			// was listed.
+			claimed, err := claimJob(j)
+			if err != nil || !claimed {
+				if err != nil {
+					log.Println("Worker error:", err)
+				}
+				queue.releaseSlot()
 				continue
 			}
 
-			go processAnalysis(id, url)
+			running[j.AnalysisID] = true
+			go runJob(j)
 		}
 
-		rows.Close()
 		time.Sleep(10 * time.Second)
 	}
 }
 
-func processAnalysis(id int, url string) {
-	_, err := db.Exec("UPDATE analyses SET status = ? WHERE id = ?", "running", id)
+func runJob(j queuedJob) {
+	defer queue.releaseSlot()
+	defer renewLease(j)()
+
+	policy, err := loadTargetPolicy()
 	if err != nil {
 		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
 		return
 	}
+	j.Options.TargetAllowed = policy.allows
+	j.Options.AddressAllowed = policy.allowsAddr
+	j.Options.MaxLinks = j.Quotas.capLinks(userQuotas().capLinks(j.Options.MaxLinks))
 
-	// Check if the analysis has been stopped
-	var status string
-	db.QueryRow("SELECT status FROM analyses WHERE id = ?", id).Scan(&status)
-	if status == "stopped" {
-		return
+	if j.Kind == jobKindLinks {
+		processLinkRecheck(j)
+	} else {
+		processAnalysis(j)
 	}
+}
 
-	analysis, err := analyzeURL(url)
+func processAnalysis(j queuedJob) {
+	id := j.AnalysisID
+	ctx, done := queue.track(j)
+	defer done()
+
+	opts := j.Options
+	opts.IfNoneMatch = j.ETag
+	opts.IfModifiedSince = j.LastModified
+	if opts.DebugCapture != nil && *opts.DebugCapture {
+		opts.Capture = &analyzer.Capture{}
+	}
+	analysis, err := analyzer.Analyze(ctx, j.URL, opts, jobProgress(j.ID, 10))
+	if ctx.Err() != nil {
+		finishJob(j, "stopped", nil)
+		return
+	}
+	if errors.Is(err, analyzer.ErrNotModified) {
+		finishUnchangedJob(j)
+		return
+	}
 	if err != nil {
-		_, dbErr := db.Exec("UPDATE analyses SET status = ? WHERE id = ?", "error", id)
-		if dbErr != nil {
-			log.Println("Worker error:", dbErr)
+		if opts.Capture != nil {
+			if err := storeDebugCapture(j, opts.Capture, err); err != nil {
+				log.Println("Worker error:", err)
+			}
 		}
+		finishJob(j, "error", err)
 		return
 	}
 
-	tx, err := db.Begin()
+	var ignored int
+	analysis.BrokenLinks, ignored, err = applyIgnoredLinks(j.ProjectID, analysis.BrokenLinks)
 	if err != nil {
 		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
 		return
 	}
+	if analysis.InaccessibleLinks != nil {
+		inaccessible := len(analysis.BrokenLinks)
+		analysis.InaccessibleLinks = &inaccessible
+	}
 
-	_, err = tx.Exec("UPDATE analyses SET html_version = ?, title = ?, h1_count = ?, h2_count = ?, h3_count = ?, h4_count = ?, h5_count = ?, h6_count = ?, internal_links = ?, external_links = ?, inaccessible_links = ?, has_login_form = ?, status = ? WHERE id = ?",
-		analysis.HTMLVersion, analysis.Title, analysis.H1Count, analysis.H2Count, analysis.H3Count, analysis.H4Count, analysis.H5Count, analysis.H6Count, analysis.InternalLinks, analysis.ExternalLinks, analysis.InaccessibleLinks, analysis.HasLoginForm, "done", id)
+	tx, err := db.Begin()
 	if err != nil {
-		tx.Rollback()
 		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
 		return
 	}
 
-	for _, link := range analysis.BrokenLinks {
-		_, err := tx.Exec("INSERT INTO broken_links (analysis_id, link) VALUES (?, ?)", id, link)
-		if err != nil {
-			tx.Rollback()
-			log.Println("Worker error:", err)
-			return
-		}
+	// The job is completed first, so a stop that arrived while the page
+	// was analyzed is noticed before any result is stored.
+	err = completeJob(tx, j, false)
+	if err == errJobStopped {
+		tx.Rollback()
+		finishJob(j, "stopped", nil)
+		return
 	}
-
-	err = tx.Commit()
 	if err != nil {
+		tx.Rollback()
 		log.Println("Worker error:", err)
-	}
-}
-
-func analyzeURL(urlStr string) (*Analysis, error) {
-	log.Printf("Analyzing URL: %s", urlStr)
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+		finishJob(j, "error", err)
+		return
 	}
 
-	resp, err := client.Get(urlStr)
+	_, err = tx.Exec("UPDATE analyses SET html_version = ?, title = ?, h1_count = ?, h2_count = ?, h3_count = ?, h4_count = ?, h5_count = ?, h6_count = ?, internal_links = ?, external_links = ?, inaccessible_links = ?, ignored_links = ?, has_login_form = ?, meta_robots = ?, x_robots_tag = ?, noindex = ?, nofollow = ?, indexable = ?, indexability_warning = ?, validation_error_count = ?, seo = ?, language = ?, word_count = ?, skipped_checks = ?, etag = ?, last_modified = ?, redirects = ? WHERE id = ?",
+		analysis.HTMLVersion, analysis.Title, analysis.H1Count, analysis.H2Count, analysis.H3Count, analysis.H4Count, analysis.H5Count, analysis.H6Count, analysis.InternalLinks, analysis.ExternalLinks, analysis.InaccessibleLinks, ignored, analysis.HasLoginForm,
+		analysis.MetaRobots, analysis.XRobotsTag, analysis.NoIndex, analysis.NoFollow, analysis.Indexable, analysis.IndexabilityWarning, analysis.ValidationErrors, analysis.SEO, analysis.Language, analysis.WordCount, analysis.SkippedChecks, analysis.ETag, analysis.LastModified, analysis.Redirects, id)
 	if err != nil {
-		return nil, err
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
-	defer resp.Body.Close()
 
-	doc, err := html.Parse(resp.Body)
-	if err != nil {
-		return nil, err
+	if err = replaceLinks(tx, id, analysis.Links, analysis.AnchorTexts); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
 
-	analysis := &Analysis{
-		URL: urlStr,
+	if err = replaceValues(tx, "broken_links", "link", id, analysis.BrokenLinks); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
 
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode {
-			switch n.Data {
-			case "title":
-				if n.FirstChild != nil {
-					analysis.Title = n.FirstChild.Data
-				}
-			case "h1":
-				analysis.H1Count++
-			case "h2":
-				analysis.H2Count++
-			case "h3":
-				analysis.H3Count++
-			case "h4":
-				analysis.H4Count++
-			case "h5":
-				analysis.H5Count++
-			case "h6":
-				analysis.H6Count++
-			case "a":
-				for _, attr := range n.Attr {
-					if attr.Key == "href" {
-						if strings.HasPrefix(attr.Val, "http") {
-							analysis.ExternalLinks++
-						} else {
-							analysis.InternalLinks++
-						}
-					}
-				}
-			case "form":
-				for _, attr := range n.Attr {
-					if attr.Key == "action" && (strings.Contains(attr.Val, "login") || strings.Contains(attr.Val, "signin")) {
-						analysis.HasLoginForm = true
-						break
-					}
-				}
-				// Also check for password input fields
-				if !analysis.HasLoginForm {
-					var checkForPassword func(*html.Node)
-					checkForPassword = func(child *html.Node) {
-						if child.Type == html.ElementNode && child.Data == "input" {
-							for _, attr := range child.Attr {
-								if attr.Key == "type" && attr.Val == "password" {
-									analysis.HasLoginForm = true
-									return
-								}
-							}
-						}
-						for c := child.FirstChild; c != nil; c = c.NextSibling {
-							checkForPassword(c)
-						}
-					}
-					checkForPassword(n)
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
+	if err = replaceLinkChecks(tx, id, false, analysis.LinkChecks); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
-	f(doc)
-
-	analysis.HTMLVersion = getHTMLVersion(doc)
 
-	analysis.BrokenLinks = checkInaccessibleLinks(doc, analysis.URL)
-	analysis.InaccessibleLinks = len(analysis.BrokenLinks)
+	if err = replaceLinkChecks(tx, id, true, analysis.DependencyChecks); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
 
-	return analysis, nil
-}
+	if err = replaceValues(tx, "validation_findings", "message", id, analysis.ValidationFindings); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
 
-func checkInaccessibleLinks(doc *html.Node, baseURL string) []string {
-	var links []string
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
-
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "a" {
-			for _, attr := range n.Attr {
-				if attr.Key == "href" {
-					link, err := url.Parse(attr.Val)
-					if err != nil {
-						continue
-					}
-
-					base, err := url.Parse(baseURL)
-					if err != nil {
-						continue
-					}
-
-					resolvedLink := base.ResolveReference(link)
-
-					resp, err := client.Get(resolvedLink.String())
-					if err != nil || (resp.StatusCode >= 400 && resp.StatusCode <= 599) {
-						links = append(links, resolvedLink.String())
-					}
-					if resp != nil {
-						resp.Body.Close()
-					}
-				}
-			}
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
+	if err = replaceKeywords(tx, id, analysis.Keywords, analysis.Bigrams); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
-	f(doc)
-	return links
-}
 
-func getHTMLVersion(doc *html.Node) string {
-	var version string
-	var f func(*html.Node)
-	f = func(n *html.Node) {
-		if n.Type == html.DoctypeNode {
-			version = n.Data
-			return
-		}
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			f(c)
-		}
+	if err = replaceHeadings(tx, id, analysis.Outline); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
 	}
-	f(doc)
-
-	if strings.Contains(strings.ToLower(version), "html 5") || version == "html" {
-		return "HTML5"
-	} else if strings.Contains(strings.ToLower(version), "xhtml 1.1") {
-		return "XHTML 1.1"
-	} else if strings.Contains(strings.ToLower(version), "xhtml 1.0") {
-		return "XHTML 1.0"
-	} else if strings.Contains(strings.ToLower(version), "html 4.01") {
-		return "HTML 4.01"
-	} else if strings.Contains(strings.ToLower(version), "html 4.0") {
-		return "HTML 4.0"
-	} else {
-		return "HTML5" // Default to HTML5 if no doctype found
+
+	err = tx.Commit()
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
 	}
-}
\ No newline at end of file
+}
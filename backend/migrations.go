@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// CREATE TABLE IF NOT EXISTS leaves tables of an existing database alone,
+// so everything added to a table after it was first released needs a
+// migration as well. Migrations run in order, once each; the versions
+// applied are recorded in schema_migrations. Every change checks
+// information_schema first, so a database that already got it from
+// schema.sql is left as is.
+
+// schemaChange is a single ALTER TABLE statement.
+type schemaChange struct {
+	kind       string
+	table      string
+	name       string
+	definition string
+}
+
+// Kinds of schema changes.
+const (
+	addColumn     = "ADD COLUMN"
+	modifyColumn  = "MODIFY COLUMN"
+	addIndex      = "ADD INDEX"
+	addForeignKey = "ADD FOREIGN KEY"
+)
+
+type migration struct {
+	version     int
+	description string
+	changes     []schemaChange
+}
+
+// migrations are applied in order. Never edit one that was released,
+// append a new one instead.
+var migrations = []migration{
+	{1, "indexability", []schemaChange{
+		{addColumn, "analyses", "meta_robots", "TEXT"},
+		{addColumn, "analyses", "x_robots_tag", "TEXT"},
+		{addColumn, "analyses", "noindex", "BOOLEAN DEFAULT FALSE"},
+		{addColumn, "analyses", "nofollow", "BOOLEAN DEFAULT FALSE"},
+		{addColumn, "analyses", "indexable", "BOOLEAN"},
+		{addColumn, "analyses", "indexability_warning", "VARCHAR(255)"},
+	}},
+	{2, "validation error count", []schemaChange{
+		{addColumn, "analyses", "validation_error_count", "INT DEFAULT 0"},
+	}},
+	{3, "conditional requests", []schemaChange{
+		{addColumn, "analyses", "etag", "VARCHAR(255)"},
+		{addColumn, "analyses", "last_modified", "VARCHAR(64)"},
+	}},
+	{4, "projects", []schemaChange{
+		{addColumn, "analyses", "project_id", "INT NULL"},
+		{addColumn, "analyses", "options", "MEDIUMTEXT"},
+		{addForeignKey, "analyses", "project_id", "REFERENCES projects(id) ON DELETE SET NULL"},
+	}},
+	{5, "crawl credentials", []schemaChange{
+		{addColumn, "analyses", "credentials", "TEXT"},
+	}},
+	{6, "analysis timestamps", []schemaChange{
+		{addColumn, "analyses", "updated_at", "TIMESTAMP DEFAULT CURRENT_TIMESTAMP"},
+		{addColumn, "analyses", "finished_at", "TIMESTAMP NULL"},
+	}},
+	{7, "keyset pagination", []schemaChange{
+		{addIndex, "analyses", "idx_analyses_created", "(created_at, id)"},
+	}},
+	{8, "long URLs", []schemaChange{
+		{modifyColumn, "analyses", "url", "VARCHAR(2048) NOT NULL"},
+	}},
+	{9, "ignored links", []schemaChange{
+		{addColumn, "analyses", "ignored_links", "INT DEFAULT 0"},
+	}},
+	{10, "keywords", []schemaChange{
+		{addColumn, "analyses", "language", "VARCHAR(16)"},
+		{addColumn, "analyses", "word_count", "INT DEFAULT 0"},
+	}},
+	{11, "redirect policy", []schemaChange{
+		{addColumn, "analyses", "redirects", "TEXT"},
+	}},
+	{12, "title and meta description", []schemaChange{
+		{addColumn, "analyses", "seo", "TEXT"},
+	}},
+	{13, "presets", []schemaChange{
+		{addColumn, "analyses", "preset", "VARCHAR(255)"},
+	}},
+	{14, "skipped checks", []schemaChange{
+		{addColumn, "analyses", "skipped_checks", "TEXT"},
+	}},
+}
+
+// migrate applies the migrations the database is missing.
+func migrate() error {
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		for _, change := range m.changes {
+			if err := applySchemaChange(change); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO schema_migrations (version) VALUES (?)", m.version); err != nil {
+			return err
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.description)
+	}
+	return nil
+}
+
+func applySchemaChange(change schemaChange) error {
+	var exists bool
+	var err error
+	switch change.kind {
+	case addColumn:
+		exists, err = schemaHas("SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?", change.table, change.name)
+	case addIndex:
+		exists, err = schemaHas("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?", change.table, change.name)
+	case addForeignKey:
+		exists, err = schemaHas("SELECT COUNT(*) FROM information_schema.key_column_usage WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ? AND referenced_table_name IS NOT NULL", change.table, change.name)
+	case modifyColumn:
+		// Modifying a column to its current definition changes nothing.
+	default:
+		return fmt.Errorf("unknown schema change %q", change.kind)
+	}
+	if err != nil || exists {
+		return err
+	}
+
+	var statement string
+	switch change.kind {
+	case addColumn, modifyColumn, addIndex:
+		statement = fmt.Sprintf("ALTER TABLE %s %s %s %s", change.table, change.kind, change.name, change.definition)
+	case addForeignKey:
+		statement = fmt.Sprintf("ALTER TABLE %s %s (%s) %s", change.table, change.kind, change.name, change.definition)
+	}
+	_, err = db.Exec(statement)
+	return err
+}
+
+// schemaHas reports whether an information_schema count query finds
+// anything.
+func schemaHas(query string, args ...any) (bool, error) {
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+func replaceHeadings(tx *sql.Tx, analysisID int, outline []analyzer.Heading) error {
+	if _, err := tx.Exec("DELETE FROM headings WHERE analysis_id = ?", analysisID); err != nil {
+		return err
+	}
+	for i, h := range outline {
+		if _, err := tx.Exec("INSERT INTO headings (analysis_id, position, level, text) VALUES (?, ?, ?, ?)", analysisID, i, h.Level, h.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadHeadings(analysisID int) ([]analyzer.Heading, error) {
+	rows, err := db.Query("SELECT level, COALESCE(text, '') FROM headings WHERE analysis_id = ? ORDER BY position", analysisID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outline := []analyzer.Heading{}
+	for rows.Next() {
+		var h analyzer.Heading
+		if err := rows.Scan(&h.Level, &h.Text); err != nil {
+			return nil, err
+		}
+		outline = append(outline, h)
+	}
+	return outline, rows.Err()
+}
+
+// getOutlineHandler returns the heading outline of an analysis.
+func getOutlineHandler(c *gin.Context) {
+	id := c.Param("id")
+
+	var analysisID int
+	err := db.QueryRow("SELECT id FROM analyses WHERE id = ?", id).Scan(&analysisID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error querying analysis %s: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query analysis"})
+		return
+	}
+
+	outline, err := loadHeadings(analysisID)
+	if err != nil {
+		log.Printf("Error querying headings: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query headings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"analysis_id": analysisID,
+		"headings":    outline,
+		"issues":      analyzer.OutlineIssues(outline),
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// The analyses list is paginated with a keyset on (created_at, id), which
+// stays fast on large tables where OFFSET has to skip every previous row.
+// Requests with a limit or cursor parameter are paginated; the cursors of
+// the adjacent pages are returned in the X-Next-Cursor and X-Prev-Cursor
+// headers and as a Link header, so the body stays a plain array.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// pageCursor points at the last row of a page. Before is set for cursors
+// that walk back towards newer analyses.
+type pageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        int       `json:"id"`
+	Before    bool      `json:"b,omitempty"`
+}
+
+func (p pageCursor) encode() string {
+	encoded, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(value string) (*pageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || cursor.ID <= 0 {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
+
+// pageRequest is a parsed limit and cursor.
+type pageRequest struct {
+	limit  int
+	cursor *pageCursor
+}
+
+// parsePageParams reads the limit and cursor query parameters. It returns
+// nil when neither is set and the whole list is requested.
+func parsePageParams(c *gin.Context) (*pageRequest, error) {
+	limitParam, cursorParam := c.Query("limit"), c.Query("cursor")
+	if limitParam == "" && cursorParam == "" {
+		return nil, nil
+	}
+
+	page := &pageRequest{limit: defaultPageSize}
+	if limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 || limit > maxPageSize {
+			return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		page.limit = limit
+	}
+	if cursorParam != "" {
+		cursor, err := decodeCursor(cursorParam)
+		if err != nil {
+			return nil, err
+		}
+		page.cursor = cursor
+	}
+	return page, nil
+}
+
+// clause returns the WHERE, ORDER BY and LIMIT part of the page query. One
+// extra row is fetched to tell whether another page follows.
+func (p *pageRequest) clause() (string, []any) {
+	if p.cursor == nil {
+		return "ORDER BY created_at DESC, id DESC LIMIT ?", []any{p.limit + 1}
+	}
+
+	t, id := p.cursor.CreatedAt, p.cursor.ID
+	if p.cursor.Before {
+		return "WHERE created_at > ? OR (created_at = ? AND id > ?) ORDER BY created_at ASC, id ASC LIMIT ?", []any{t, t, id, p.limit + 1}
+	}
+	return "WHERE created_at < ? OR (created_at = ? AND id < ?) ORDER BY created_at DESC, id DESC LIMIT ?", []any{t, t, id, p.limit + 1}
+}
+
+// trim cuts the extra row, restores newest first order and returns the
+// cursors of the previous and next pages, empty when there is none.
+func (p *pageRequest) trim(analyses []Analysis) ([]Analysis, string, string) {
+	more := len(analyses) > p.limit
+	if more {
+		analyses = analyses[:p.limit]
+	}
+
+	backwards := p.cursor != nil && p.cursor.Before
+	if backwards {
+		for i, j := 0, len(analyses)-1; i < j; i, j = i+1, j-1 {
+			analyses[i], analyses[j] = analyses[j], analyses[i]
+		}
+	}
+	if len(analyses) == 0 {
+		return analyses, "", ""
+	}
+
+	first, last := analyses[0], analyses[len(analyses)-1]
+	var prev, next string
+	if (backwards && more) || (!backwards && p.cursor != nil) {
+		prev = pageCursor{CreatedAt: first.CreatedAt, ID: first.ID, Before: true}.encode()
+	}
+	if (!backwards && more) || backwards {
+		next = pageCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+	return analyses, prev, next
+}
+
+// setPageHeaders exposes the cursors of the adjacent pages.
+func setPageHeaders(c *gin.Context, limit int, prev, next string) {
+	link := func(cursor, rel string) string {
+		query := c.Request.URL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("cursor", cursor)
+		u := url.URL{Path: c.Request.URL.Path, RawQuery: query.Encode()}
+		return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+	}
+
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
+		c.Writer.Header().Add("Link", link(next, "next"))
+	}
+	if prev != "" {
+		c.Header("X-Prev-Cursor", prev)
+		c.Writer.Header().Add("Link", link(prev, "prev"))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// Preset is a named bundle of analyzer options, such as "Quick scan" or
+// "Full SEO audit". Analyses submitted with a preset name get its options
+// layered between the project settings and their own options.
+type Preset struct {
+	ID          int              `json:"id"`
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	Options     analyzer.Options `json:"options"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+type presetBody struct {
+	Name        string           `json:"name" binding:"required,max=255"`
+	Description string           `json:"description" binding:"max=1024"`
+	Options     analyzer.Options `json:"options"`
+}
+
+func loadPreset(query string, arg any) (*Preset, error) {
+	var p Preset
+	err := db.QueryRow("SELECT id, name, COALESCE(description, ''), options, created_at FROM presets WHERE "+query, arg).Scan(&p.ID, &p.Name, &p.Description, &p.Options, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.CreatedAt = p.CreatedAt.UTC()
+	return &p, nil
+}
+
+// presetOptions returns the options of the named preset, or nothing when
+// name is empty.
+func presetOptions(name string) (analyzer.Options, error) {
+	if name == "" {
+		return analyzer.Options{}, nil
+	}
+	preset, err := loadPreset("name = ?", name)
+	if err != nil {
+		return analyzer.Options{}, err
+	}
+	return preset.Options, nil
+}
+
+// resolvePreset layers the options of the named preset under options,
+// answering the request itself when the preset cannot be loaded.
+func resolvePreset(c *gin.Context, name string, options analyzer.Options) (analyzer.Options, bool) {
+	preset, err := presetOptions(name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Preset not found"})
+		return analyzer.Options{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return analyzer.Options{}, false
+	}
+	return preset.Merge(options), true
+}
+
+// presetFromParam loads the preset named by the :id path parameter,
+// answering the request itself when it cannot.
+func presetFromParam(c *gin.Context) (*Preset, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preset id"})
+		return nil, false
+	}
+
+	preset, err := loadPreset("id = ?", id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preset not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error querying preset %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query preset"})
+		return nil, false
+	}
+	return preset, true
+}
+
+// presetNameTaken answers 409 when another preset than id uses name.
+func presetNameTaken(c *gin.Context, name string, id int) bool {
+	existing, err := loadPreset("name = ?", name)
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return true
+	}
+	if existing.ID == id {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": "A preset with this name already exists"})
+	return true
+}
+
+func createPresetHandler(c *gin.Context) {
+	var body presetBody
+	if !bindBody(c, &body) || presetNameTaken(c, body.Name, 0) {
+		return
+	}
+
+	result, err := db.Exec("INSERT INTO presets (name, description, options) VALUES (?, ?, ?)", body.Name, body.Description, body.Options)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	preset, err := loadPreset("id = ?", id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, preset)
+}
+
+func getPresetsHandler(c *gin.Context) {
+	rows, err := db.Query("SELECT id, name, COALESCE(description, ''), options, created_at FROM presets ORDER BY name")
+	if err != nil {
+		log.Printf("Error querying presets: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query presets"})
+		return
+	}
+	defer rows.Close()
+
+	presets := []Preset{}
+	for rows.Next() {
+		var p Preset
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.Options, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning preset row: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan preset row"})
+			return
+		}
+		p.CreatedAt = p.CreatedAt.UTC()
+		presets = append(presets, p)
+	}
+
+	c.JSON(http.StatusOK, presets)
+}
+
+func getPresetHandler(c *gin.Context) {
+	preset, ok := presetFromParam(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, preset)
+}
+
+func updatePresetHandler(c *gin.Context) {
+	preset, ok := presetFromParam(c)
+	if !ok {
+		return
+	}
+
+	var body presetBody
+	if !bindBody(c, &body) || presetNameTaken(c, body.Name, preset.ID) {
+		return
+	}
+
+	_, err := db.Exec("UPDATE presets SET name = ?, description = ?, options = ? WHERE id = ?", body.Name, body.Description, body.Options, preset.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	preset.Name = body.Name
+	preset.Description = body.Description
+	preset.Options = body.Options
+	c.JSON(http.StatusOK, preset)
+}
+
+func deletePresetHandler(c *gin.Context) {
+	_, err := db.Exec("DELETE FROM presets WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
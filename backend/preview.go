@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// Budget of a preview run. Previews run inside the request, so they are
+// kept well below typical proxy timeouts.
+const (
+	previewTimeout  = 20 * time.Second
+	previewMaxLinks = 25
+
+	defaultMaxConcurrentPreviews = 4
+)
+
+var errPreviewsBusy = errors.New("too many previews running")
+
+// previewLimiter limits the previews running at the same time, overall and
+// per user. Previews run outside the worker, so its slots do not cover
+// them; the per-user limit is the concurrency quota shared with the user's
+// running jobs.
+type previewLimiter struct {
+	slots chan struct{}
+
+	mu     sync.Mutex
+	byUser map[string]int
+}
+
+var previews = &previewLimiter{
+	slots:  make(chan struct{}, maxConcurrentPreviews()),
+	byUser: map[string]int{},
+}
+
+func maxConcurrentPreviews() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_PREVIEWS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxConcurrentPreviews
+}
+
+// acquire reserves a preview slot for user without blocking. It fails with
+// errPreviewsBusy when every slot is busy and with a *quotaError when the
+// user is at the concurrency limit.
+func (p *previewLimiter) acquire(user string) error {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return errPreviewsBusy
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if limit := userQuotas().MaxConcurrentJobs; limit > 0 {
+		running, err := runningJobs(quotaScopeUser, user)
+		if err == nil && running+p.byUser[user] >= limit {
+			err = &quotaError{Scope: quotaScopeUser, Quota: "max_concurrent_jobs", Limit: limit}
+		}
+		if err != nil {
+			<-p.slots
+			return err
+		}
+	}
+	p.byUser[user]++
+	return nil
+}
+
+func (p *previewLimiter) release(user string) {
+	p.mu.Lock()
+	p.byUser[user]--
+	if p.byUser[user] <= 0 {
+		delete(p.byUser, user)
+	}
+	p.mu.Unlock()
+	<-p.slots
+}
+
+// running counts the running previews of user.
+func (p *previewLimiter) running(user string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.byUser[user]
+}
+
+// previewHandler analyzes a URL inline and returns the result without
+// storing anything, so users can try a URL or options before queueing it.
+// Previews count towards the same quotas as queued jobs.
+func previewHandler(c *gin.Context) {
+	var body struct {
+		URL         string           `json:"url" binding:"required,max=2048,httpurl"`
+		ProjectID   int              `json:"project_id" binding:"min=0"`
+		Preset      string           `json:"preset" binding:"max=255"`
+		Options     analyzer.Options `json:"options"`
+		Credentials crawlCredentials `json:"credentials"`
+	}
+	if !bindBody(c, &body) || !targetAllowed(c, body.URL) {
+		return
+	}
+
+	defaults, credentials, err := projectSettings(body.ProjectID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Project not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	projectQuotas, err := loadProjectQuotas(body.ProjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	options, ok := resolvePreset(c, body.Preset, body.Options)
+	if !ok {
+		return
+	}
+
+	policy, err := loadTargetPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts := defaults.Merge(options)
+	opts.TargetAllowed = policy.allows
+	opts.AddressAllowed = policy.allowsAddr
+	opts.Credentials = analyzer.Credentials(credentials.merge(body.Credentials))
+	if opts.MaxLinks <= 0 || opts.MaxLinks > previewMaxLinks {
+		opts.MaxLinks = previewMaxLinks
+	}
+	opts.MaxLinks = projectQuotas.capLinks(userQuotas().capLinks(opts.MaxLinks))
+	if opts.PageTimeout() > previewTimeout {
+		opts.TimeoutSeconds = int(previewTimeout / time.Second)
+	}
+
+	user := currentUser(c)
+	err = previews.acquire(user)
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		respondQuotaExceeded(c, quotaErr)
+		return
+	}
+	if err == errPreviewsBusy {
+		c.Header("Retry-After", strconv.Itoa(int(previewTimeout/time.Second)))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Too many previews running, try again later"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer previews.release(user)
+
+	err = countPreview(user, body.ProjectID, projectQuotas)
+	if errors.As(err, &quotaErr) {
+		respondQuotaExceeded(c, quotaErr)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), previewTimeout)
+	defer cancel()
+
+	result, err := analyzer.Analyze(ctx, body.URL, opts, nil)
+	if err != nil {
+		log.Printf("Preview of %s failed: %v", body.URL, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, Analysis{Result: *result, Status: "preview"})
+}
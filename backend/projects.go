@@ -0,0 +1,239 @@
+package main
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// Project groups analyses and holds the default analyzer settings applied
+// to every analysis created under it.
+type Project struct {
+	ID             int              `json:"id"`
+	Name           string           `json:"name"`
+	Settings       analyzer.Options `json:"settings"`
+	Quotas         quotaLimits      `json:"quotas"`
+	HasCredentials bool             `json:"has_credentials"`
+	HasWebhook     bool             `json:"has_webhook"`
+	CreatedAt      time.Time        `json:"created_at"`
+
+	credentials sql.NullString
+}
+
+// crawlCredentials decrypts the stored default credentials of the project.
+func (p *Project) crawlCredentials() (crawlCredentials, error) {
+	var credentials crawlCredentials
+	err := credentials.open(nullStringValue(p.credentials), secretScope{"projects", "credentials", p.ID})
+	return credentials, err
+}
+
+// projectBody is the payload of create and update requests. Stored
+// credentials cannot be read back, so an update without credentials keeps
+// them unless clear_credentials is set. An update without quotas keeps the
+// stored ones.
+type projectBody struct {
+	Name             string           `json:"name" binding:"required,max=255"`
+	Settings         analyzer.Options `json:"settings"`
+	Quotas           *quotaLimits     `json:"quotas"`
+	Credentials      crawlCredentials `json:"credentials"`
+	ClearCredentials bool             `json:"clear_credentials"`
+}
+
+func bindProjectBody(c *gin.Context) (*projectBody, bool) {
+	var body projectBody
+	if !bindBody(c, &body) {
+		return nil, false
+	}
+	// Quotas limit what the project may use, so only admins may set them.
+	if body.Quotas != nil && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin token required to set quotas"})
+		return nil, false
+	}
+	if !credentialsStorable(c, body.Credentials) {
+		return nil, false
+	}
+	return &body, true
+}
+
+func loadProject(id int) (*Project, error) {
+	var p Project
+	err := db.QueryRow("SELECT id, name, settings, quotas, credentials, webhook_token IS NOT NULL, created_at FROM projects WHERE id = ?", id).Scan(&p.ID, &p.Name, &p.Settings, &p.Quotas, &p.credentials, &p.HasWebhook, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.HasCredentials = p.credentials.Valid
+	p.CreatedAt = p.CreatedAt.UTC()
+	return &p, nil
+}
+
+// projectFromParam loads the project named by the :id path parameter,
+// answering the request itself when it cannot.
+func projectFromParam(c *gin.Context) (*Project, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project id"})
+		return nil, false
+	}
+
+	project, err := loadProject(id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error querying project %d: %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query project"})
+		return nil, false
+	}
+	return project, true
+}
+
+// projectSettings returns the default settings and credentials of a
+// project, or nothing when projectID is 0.
+func projectSettings(projectID int) (analyzer.Options, crawlCredentials, error) {
+	if projectID == 0 {
+		return analyzer.Options{}, crawlCredentials{}, nil
+	}
+	project, err := loadProject(projectID)
+	if err != nil {
+		return analyzer.Options{}, crawlCredentials{}, err
+	}
+
+	credentials, err := project.crawlCredentials()
+	return project.Settings, credentials, err
+}
+
+func createProjectHandler(c *gin.Context) {
+	body, ok := bindProjectBody(c)
+	if !ok {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var quotas quotaLimits
+	if body.Quotas != nil {
+		quotas = *body.Quotas
+	}
+
+	result, err := tx.Exec("INSERT INTO projects (name, settings, quotas) VALUES (?, ?, ?)", body.Name, body.Settings, quotas)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	if !body.Credentials.empty() {
+		if err := storeCredentials(tx, "projects", int(id), body.Credentials); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	project, err := loadProject(int(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, project)
+}
+
+func getProjectsHandler(c *gin.Context) {
+	rows, err := db.Query("SELECT id, name, settings, quotas, credentials IS NOT NULL, webhook_token IS NOT NULL, created_at FROM projects ORDER BY name")
+	if err != nil {
+		log.Printf("Error querying projects: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query projects"})
+		return
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.ID, &p.Name, &p.Settings, &p.Quotas, &p.HasCredentials, &p.HasWebhook, &p.CreatedAt); err != nil {
+			log.Printf("Error scanning project row: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan project row"})
+			return
+		}
+		p.CreatedAt = p.CreatedAt.UTC()
+		projects = append(projects, p)
+	}
+
+	c.JSON(http.StatusOK, projects)
+}
+
+func getProjectHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, project)
+}
+
+func updateProjectHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	body, ok := bindProjectBody(c)
+	if !ok {
+		return
+	}
+
+	if body.Quotas != nil {
+		project.Quotas = *body.Quotas
+	}
+
+	_, err := db.Exec("UPDATE projects SET name = ?, settings = ?, quotas = ? WHERE id = ?", body.Name, body.Settings, project.Quotas, project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if body.ClearCredentials || !body.Credentials.empty() {
+		if err := storeCredentials(db, "projects", project.ID, body.Credentials); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		project.HasCredentials = !body.Credentials.empty()
+	}
+
+	project.Name = body.Name
+	project.Settings = body.Settings
+	c.JSON(http.StatusOK, project)
+}
+
+func deleteProjectHandler(c *gin.Context) {
+	_, err := db.Exec("DELETE FROM projects WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// nullableID stores 0 as NULL for optional foreign keys.
+func nullableID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
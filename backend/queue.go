@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runningJob is a job currently being processed by this instance.
+type runningJob struct {
+	job       queuedJob
+	startedAt time.Time
+	cancel    context.CancelFunc
+}
+
+// workerState is the in-process control state of the worker. Pausing stops
+// the worker from starting queued jobs; draining additionally rejects new
+// submissions while running jobs finish. slots limits how many jobs run at
+// the same time.
+type workerState struct {
+	mu       sync.Mutex
+	paused   bool
+	draining bool
+	running  map[int]*runningJob
+	slots    chan struct{}
+}
+
+const defaultMaxConcurrentAnalyses = 4
+
+var queue = &workerState{
+	running: map[int]*runningJob{},
+	slots:   make(chan struct{}, maxConcurrentAnalyses()),
+}
+
+func maxConcurrentAnalyses() int {
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_ANALYSES")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxConcurrentAnalyses
+}
+
+// acquireSlot reserves a worker slot without blocking. It returns false
+// when every slot is busy.
+func (q *workerState) acquireSlot() bool {
+	select {
+	case q.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *workerState) releaseSlot() {
+	<-q.slots
+}
+
+// intakeStopped reports whether the worker should leave queued jobs alone.
+func (q *workerState) intakeStopped() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.paused || q.draining
+}
+
+func (q *workerState) accepting() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.draining
+}
+
+// track registers a job as running and returns the context it must run
+// under. The returned function unregisters it.
+func (q *workerState) track(j queuedJob) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	q.mu.Lock()
+	q.running[j.ID] = &runningJob{job: j, startedAt: time.Now(), cancel: cancel}
+	q.mu.Unlock()
+
+	return ctx, func() {
+		q.mu.Lock()
+		delete(q.running, j.ID)
+		q.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelAnalysis cancels running jobs of an analysis.
+func (q *workerState) cancelAnalysis(analysisID int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, r := range q.running {
+		if r.job.AnalysisID == analysisID {
+			r.cancel()
+		}
+	}
+}
+
+// cancelAll cancels every running job and returns their IDs.
+func (q *workerState) cancelAll() []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	ids := make([]int, 0, len(q.running))
+	for id, r := range q.running {
+		r.cancel()
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (q *workerState) status() gin.H {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return gin.H{
+		"paused":   q.paused,
+		"draining": q.draining,
+		"drained":  q.draining && len(q.running) == 0,
+		"running":  len(q.running),
+	}
+}
+
+// rejectWhileDraining answers 503 and returns true when the queue does not
+// accept new jobs.
+func rejectWhileDraining(c *gin.Context) bool {
+	if queue.accepting() {
+		return false
+	}
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Queue is draining, new analyses are not accepted"})
+	return true
+}
+
+func pauseQueueHandler(c *gin.Context) {
+	queue.mu.Lock()
+	queue.paused = true
+	queue.mu.Unlock()
+
+	c.JSON(http.StatusOK, queue.status())
+}
+
+func resumeQueueHandler(c *gin.Context) {
+	queue.mu.Lock()
+	queue.paused = false
+	queue.draining = false
+	queue.mu.Unlock()
+
+	c.JSON(http.StatusOK, queue.status())
+}
+
+func drainQueueHandler(c *gin.Context) {
+	queue.mu.Lock()
+	queue.draining = true
+	queue.mu.Unlock()
+
+	c.JSON(http.StatusOK, queue.status())
+}
+
+// stopAllHandler stops every running analysis. Queued jobs stay queued.
+func stopAllHandler(c *gin.Context) {
+	_, err := db.Exec("UPDATE analyses SET status = ?, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP WHERE id IN (SELECT analysis_id FROM jobs WHERE state = ?)", "stopped", "running")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = db.Exec("UPDATE jobs SET state = ?, finished_at = CURRENT_TIMESTAMP WHERE state = ?", "stopped", "running")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stopped := queue.cancelAll()
+
+	c.JSON(http.StatusOK, gin.H{"stopped_jobs": stopped})
+}
+
+// queueStatusHandler reports queue depth, running jobs and worker usage so
+// operators can see why analyses are slow.
+func queueStatusHandler(c *gin.Context) {
+	rows, err := db.Query("SELECT state, priority, COUNT(*) FROM jobs GROUP BY state, priority ORDER BY state, priority DESC")
+	if err != nil {
+		log.Printf("Error querying queue depth: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query queue depth"})
+		return
+	}
+	defer rows.Close()
+
+	type depth struct {
+		State    string `json:"state"`
+		Priority int    `json:"priority"`
+		Count    int    `json:"count"`
+	}
+	depths := []depth{}
+	byState := map[string]int{}
+	for rows.Next() {
+		var d depth
+		if err := rows.Scan(&d.State, &d.Priority, &d.Count); err != nil {
+			log.Printf("Error scanning queue depth: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan queue depth"})
+			return
+		}
+		depths = append(depths, d)
+		byState[d.State] += d.Count
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating queue depth: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query queue depth"})
+		return
+	}
+
+	var oldestQueuedAge sql.NullInt64
+	err = db.QueryRow("SELECT TIMESTAMPDIFF(SECOND, MIN(created_at), CURRENT_TIMESTAMP) FROM jobs WHERE state = ?", "queued").Scan(&oldestQueuedAge)
+	if err != nil {
+		log.Printf("Error querying oldest queued job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query oldest queued job"})
+		return
+	}
+
+	type running struct {
+		JobID          int       `json:"job_id"`
+		AnalysisID     int       `json:"analysis_id"`
+		URL            string    `json:"url"`
+		Kind           string    `json:"kind"`
+		StartedAt      time.Time `json:"started_at"`
+		ElapsedSeconds float64   `json:"elapsed_seconds"`
+	}
+
+	queue.mu.Lock()
+	runningJobs := make([]running, 0, len(queue.running))
+	for _, r := range queue.running {
+		runningJobs = append(runningJobs, running{
+			JobID:          r.job.ID,
+			AnalysisID:     r.job.AnalysisID,
+			URL:            r.job.URL,
+			Kind:           r.job.Kind,
+			StartedAt:      r.startedAt.UTC(),
+			ElapsedSeconds: time.Since(r.startedAt).Seconds(),
+		})
+	}
+	paused, draining := queue.paused, queue.draining
+	queue.mu.Unlock()
+
+	sort.Slice(runningJobs, func(i, k int) bool { return runningJobs[i].StartedAt.Before(runningJobs[k].StartedAt) })
+
+	response := gin.H{
+		"paused":   paused,
+		"draining": draining,
+		"depth":    depths,
+		"by_state": byState,
+		"running":  runningJobs,
+		"workers": gin.H{
+			"busy":        len(queue.slots),
+			"limit":       cap(queue.slots),
+			"utilization": float64(len(queue.slots)) / float64(cap(queue.slots)),
+		},
+		"oldest_queued_age_seconds": nil,
+	}
+	if oldestQueuedAge.Valid {
+		response["oldest_queued_age_seconds"] = oldestQueuedAge.Int64
+	}
+
+	c.JSON(http.StatusOK, response)
+}
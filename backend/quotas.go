@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/dbjson"
+)
+
+// Quotas keep one user or project from monopolizing the crawler. Users are
+// told apart by a hash of their bearer token; any token is accepted, so a
+// new token starts with fresh per-user quotas. Only admins set project
+// quotas. The daily analysis limit is
+// enforced when jobs are submitted, the concurrency limit when the worker
+// starts them and the crawl page limit caps the links checked per run.
+// Previews are held to the same limits when they run.
+// Per-user limits come from the environment, per-project limits are stored
+// with the project.
+
+const userContextKey = "user"
+
+// Quota scopes.
+const (
+	quotaScopeUser    = "user"
+	quotaScopeProject = "project"
+)
+
+// quotaLimits are the limits of a user or project. Zero means unlimited.
+type quotaLimits struct {
+	MaxAnalysesPerDay int `json:"max_analyses_per_day,omitempty" binding:"min=0,max=100000"`
+	MaxConcurrentJobs int `json:"max_concurrent_jobs,omitempty" binding:"min=0,max=100"`
+	MaxCrawlPages     int `json:"max_crawl_pages,omitempty" binding:"min=0,max=10000"`
+}
+
+// userQuotas returns the limits applied to every user.
+func userQuotas() quotaLimits {
+	return quotaLimits{
+		MaxAnalysesPerDay: envLimit("USER_MAX_ANALYSES_PER_DAY"),
+		MaxConcurrentJobs: envLimit("USER_MAX_CONCURRENT_JOBS"),
+		MaxCrawlPages:     envLimit("USER_MAX_CRAWL_PAGES"),
+	}
+}
+
+func envLimit(key string) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// capLinks lowers maxLinks to the crawl page limit.
+func (q quotaLimits) capLinks(maxLinks int) int {
+	if q.MaxCrawlPages > 0 && (maxLinks == 0 || maxLinks > q.MaxCrawlPages) {
+		return q.MaxCrawlPages
+	}
+	return maxLinks
+}
+
+// userID identifies the user behind a bearer token without storing it.
+func userID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+func currentUser(c *gin.Context) string {
+	return c.GetString(userContextKey)
+}
+
+// quotaError reports a submission over a quota.
+type quotaError struct {
+	Scope string
+	Quota string
+	Limit int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s quota %s of %d exceeded", e.Scope, e.Quota, e.Limit)
+}
+
+// countSubmission adds a submission to today's usage of a user or project
+// and fails with a quotaError when that goes over limit. The usage row
+// stays locked until tx ends, so concurrent submissions are counted one
+// after the other, and rolling tx back undoes the count.
+func countSubmission(tx *sql.Tx, scope, subject string, limit int) error {
+	_, err := tx.Exec("INSERT INTO quota_usage (scope, subject, day, analyses) VALUES (?, ?, CURRENT_DATE, 1) ON DUPLICATE KEY UPDATE analyses = analyses + 1", scope, subject)
+	if err != nil || limit == 0 {
+		return err
+	}
+
+	var used int
+	err = tx.QueryRow("SELECT analyses FROM quota_usage WHERE scope = ? AND subject = ? AND day = CURRENT_DATE", scope, subject).Scan(&used)
+	if err != nil {
+		return err
+	}
+	if used > limit {
+		return &quotaError{Scope: scope, Quota: "max_analyses_per_day", Limit: limit}
+	}
+	return nil
+}
+
+// countPreview counts a preview towards the daily quotas of user and of
+// the project, like a queued job.
+func countPreview(user string, projectID int, projectQuotas quotaLimits) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := countSubmission(tx, quotaScopeUser, user, userQuotas().MaxAnalysesPerDay); err != nil {
+		return err
+	}
+	if projectID != 0 {
+		if err := countSubmission(tx, quotaScopeProject, strconv.Itoa(projectID), projectQuotas.MaxAnalysesPerDay); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// loadProjectQuotas returns the limits of a project, or no limits when
+// projectID is 0.
+func loadProjectQuotas(projectID int) (quotaLimits, error) {
+	var quotas quotaLimits
+	if projectID == 0 {
+		return quotas, nil
+	}
+	err := db.QueryRow("SELECT quotas FROM projects WHERE id = ?", projectID).Scan(&quotas)
+	return quotas, err
+}
+
+// nextQuotaReset is when the daily counts start over.
+func nextQuotaReset() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// respondQuotaExceeded answers 429 with the time the quota resets. The
+// concurrency limit is only hit by previews, which finish within
+// previewTimeout.
+func respondQuotaExceeded(c *gin.Context, err *quotaError) {
+	retryAfter := time.Until(nextQuotaReset())
+	if err.Quota == "max_concurrent_jobs" {
+		retryAfter = previewTimeout
+	}
+	c.Header("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error": "Quota exceeded",
+		"scope": err.Scope,
+		"quota": err.Quota,
+		"limit": err.Limit,
+	})
+}
+
+// runningJobs counts the running jobs of a user or project.
+func runningJobs(scope, subject string) (int, error) {
+	var running int
+	var err error
+	if scope == quotaScopeUser {
+		err = db.QueryRow("SELECT COUNT(*) FROM jobs WHERE state = ? AND owner = ?", "running", subject).Scan(&running)
+	} else {
+		err = db.QueryRow("SELECT COUNT(*) FROM jobs JOIN analyses ON analyses.id = jobs.analysis_id WHERE jobs.state = ? AND analyses.project_id = ?", "running", subject).Scan(&running)
+	}
+	return running, err
+}
+
+// startAllowed reports whether a queued job may start without going over
+// the concurrency limit of its user or project. The user's running
+// previews count as well. Jobs that may not start stay queued.
+func startAllowed(j queuedJob) (bool, error) {
+	if limit := userQuotas().MaxConcurrentJobs; limit > 0 && j.Owner != "" {
+		running, err := runningJobs(quotaScopeUser, j.Owner)
+		if err != nil || running+previews.running(j.Owner) >= limit {
+			return false, err
+		}
+	}
+	if limit := j.Quotas.MaxConcurrentJobs; limit > 0 && j.ProjectID != 0 {
+		running, err := runningJobs(quotaScopeProject, strconv.Itoa(j.ProjectID))
+		if err != nil || running >= limit {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// quotaUsage is the usage of a user or project next to its limits.
+type quotaUsage struct {
+	Limits        quotaLimits `json:"limits"`
+	AnalysesToday int         `json:"analyses_today"`
+	RunningJobs   int         `json:"running_jobs"`
+	ResetsAt      time.Time   `json:"resets_at"`
+}
+
+func loadQuotaUsage(scope, subject string, limits quotaLimits) (*quotaUsage, error) {
+	usage := quotaUsage{Limits: limits, ResetsAt: nextQuotaReset()}
+	err := db.QueryRow("SELECT COALESCE(SUM(analyses), 0) FROM quota_usage WHERE scope = ? AND subject = ? AND day = CURRENT_DATE", scope, subject).Scan(&usage.AnalysesToday)
+	if err != nil {
+		return nil, err
+	}
+	usage.RunningJobs, err = runningJobs(scope, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &usage, nil
+}
+
+// getUsageHandler returns the quota usage of the calling user.
+func getUsageHandler(c *gin.Context) {
+	usage, err := loadQuotaUsage(quotaScopeUser, currentUser(c), userQuotas())
+	if err != nil {
+		log.Printf("Error querying quota usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query quota usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// getProjectUsageHandler returns the quota usage of a project.
+func getProjectUsageHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	usage, err := loadQuotaUsage(quotaScopeProject, strconv.Itoa(project.ID), project.Quotas)
+	if err != nil {
+		log.Printf("Error querying quota usage: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query quota usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// Scan reads limits stored as JSON. NULL reads as no limits.
+func (q *quotaLimits) Scan(src any) error {
+	return dbjson.Scan(q, src)
+}
+
+// Value stores limits as JSON.
+func (q quotaLimits) Value() (driver.Value, error) {
+	return dbjson.Value(q)
+}
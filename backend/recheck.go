@@ -0,0 +1,121 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+func recheckLinksHandler(c *gin.Context) {
+	var body struct {
+		ID int `json:"id" binding:"required,min=1"`
+	}
+	if !bindBody(c, &body) {
+		return
+	}
+
+	var linkCount int
+	err := db.QueryRow("SELECT COUNT(*) FROM links WHERE analysis_id = ?", body.ID).Scan(&linkCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if linkCount == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "No stored link set, run a full analysis first"})
+		return
+	}
+
+	submitJob(c, body.ID, jobKindLinks)
+}
+
+// processLinkRecheck re-verifies the stored link set of an analysis and
+// replaces its broken links without fetching the page again.
+func processLinkRecheck(j queuedJob) {
+	id := j.AnalysisID
+	ctx, done := queue.track(j)
+	defer done()
+
+	links, err := loadValues("links", "link", id)
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	checks, err := analyzer.CheckLinks(ctx, j.URL, links, j.Options, jobProgress(j.ID, 0))
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+	if ctx.Err() != nil {
+		finishJob(j, "stopped", nil)
+		return
+	}
+
+	brokenLinks, ignored, err := applyIgnoredLinks(j.ProjectID, analyzer.FailedLinks(checks))
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	err = completeJob(tx, j, false)
+	if err == errJobStopped {
+		tx.Rollback()
+		finishJob(j, "stopped", nil)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	if err = replaceValues(tx, "broken_links", "link", id, brokenLinks); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	if err = replaceLinkChecks(tx, id, false, checks); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	// The links are checked now even if the last full run skipped them.
+	var skipped analyzer.CheckList
+	if err = tx.QueryRow("SELECT skipped_checks FROM analyses WHERE id = ?", id).Scan(&skipped); err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	_, err = tx.Exec("UPDATE analyses SET inaccessible_links = ?, ignored_links = ?, skipped_checks = ? WHERE id = ?", len(brokenLinks), ignored, skipped.Without("links"), id)
+	if err != nil {
+		tx.Rollback()
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println("Worker error:", err)
+		finishJob(j, "error", err)
+	}
+}
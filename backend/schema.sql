@@ -1,6 +1,39 @@
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INT PRIMARY KEY,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS projects (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    settings MEDIUMTEXT,
+    quotas TEXT,
+    credentials TEXT,
+    webhook_token TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS presets (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    options MEDIUMTEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Separator between tables
+
 CREATE TABLE IF NOT EXISTS analyses (
     id INT AUTO_INCREMENT PRIMARY KEY,
-    url VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    project_id INT NULL,
+    options MEDIUMTEXT,
+    preset VARCHAR(255),
+    credentials TEXT,
     html_version VARCHAR(255),
     title VARCHAR(255),
     h1_count INT DEFAULT 0,
@@ -12,9 +45,28 @@ CREATE TABLE IF NOT EXISTS analyses (
     internal_links INT DEFAULT 0,
     external_links INT DEFAULT 0,
     inaccessible_links INT DEFAULT 0,
+    ignored_links INT DEFAULT 0,
     has_login_form BOOLEAN,
+    meta_robots TEXT,
+    x_robots_tag TEXT,
+    noindex BOOLEAN DEFAULT FALSE,
+    nofollow BOOLEAN DEFAULT FALSE,
+    indexable BOOLEAN,
+    indexability_warning VARCHAR(255),
+    validation_error_count INT DEFAULT 0,
+    seo TEXT,
+    language VARCHAR(16),
+    word_count INT DEFAULT 0,
+    skipped_checks TEXT,
+    etag VARCHAR(255),
+    last_modified VARCHAR(64),
+    redirects TEXT,
     status VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP NULL,
+    INDEX idx_analyses_created (created_at, id),
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL
 );
 
 -- Separator between tables
@@ -24,4 +76,129 @@ CREATE TABLE IF NOT EXISTS broken_links (
     analysis_id INT,
     link TEXT,
     FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS links (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT,
+    link TEXT,
+    anchor_text VARCHAR(255),
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS link_checks (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT,
+    url TEXT,
+    status INT DEFAULT 0,
+    error TEXT,
+    error_class VARCHAR(32),
+    redirect_status INT DEFAULT 0,
+    final_url TEXT,
+    redirect_decision VARCHAR(32),
+    duration_ms INT DEFAULT 0,
+    size_bytes BIGINT DEFAULT 0,
+    external BOOLEAN DEFAULT FALSE,
+    resource BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS validation_findings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT,
+    message TEXT,
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS keywords (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT,
+    kind VARCHAR(16) NOT NULL,
+    term VARCHAR(255) NOT NULL,
+    count INT DEFAULT 0,
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS headings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT,
+    position INT NOT NULL,
+    level TINYINT NOT NULL,
+    text VARCHAR(255),
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS ignored_links (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    project_id INT NOT NULL,
+    link VARCHAR(2048) NOT NULL,
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS debug_captures (
+    analysis_id INT PRIMARY KEY,
+    job_id INT,
+    error TEXT,
+    exchanges MEDIUMTEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS target_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    action VARCHAR(16) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    value VARCHAR(2048) NOT NULL,
+    note TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    analysis_id INT NOT NULL,
+    kind VARCHAR(32) NOT NULL DEFAULT 'full',
+    state VARCHAR(32) NOT NULL,
+    priority INT NOT NULL DEFAULT 0,
+    progress INT DEFAULT 0,
+    unchanged BOOLEAN NOT NULL DEFAULT FALSE,
+    owner VARCHAR(32),
+    worker_id VARCHAR(64),
+    lease_expires_at TIMESTAMP NULL,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP NULL,
+    finished_at TIMESTAMP NULL,
+    INDEX idx_jobs_queue (state, priority, id),
+    INDEX idx_jobs_analysis_state (analysis_id, state),
+    FOREIGN KEY (analysis_id) REFERENCES analyses(id) ON DELETE CASCADE
+);
+
+-- Separator between tables
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    scope VARCHAR(16) NOT NULL,
+    subject VARCHAR(64) NOT NULL,
+    day DATE NOT NULL,
+    analyses INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (scope, subject, day)
 );
\ No newline at end of file
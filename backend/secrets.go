@@ -0,0 +1,353 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sensitive columns are encrypted with AES-256-GCM. Keys come from
+// SECRETS_KEYS, a comma separated list of id:base64key pairs; the first key
+// encrypts new values and the others are kept to decrypt values written
+// before a rotation. A KMS can provide the variable at deploy time.
+//
+// Stored values look like "v1:<key id>:<base64 nonce+ciphertext>". The key
+// id and the table, column and row the value is stored in are
+// authenticated with it, so a value copied to another row or column does
+// not decrypt.
+
+const secretFormatVersion = "v1"
+
+var (
+	errSecretsDisabled = errors.New("secrets encryption is not configured, set SECRETS_KEYS")
+	errMalformedSecret = errors.New("malformed encrypted value")
+)
+
+// secretScope is where an encrypted value is stored.
+type secretScope struct {
+	table  string
+	column string
+	id     int
+}
+
+func (s secretScope) additionalData(keyID string) []byte {
+	return fmt.Appendf(nil, "%s:%s:%s.%s:%d", secretFormatVersion, keyID, s.table, s.column, s.id)
+}
+
+type secretKeyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+var (
+	keyringOnce sync.Once
+	keyring     *secretKeyring
+	keyringErr  error
+)
+
+func secretsKeyring() (*secretKeyring, error) {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = parseKeyring(os.Getenv("SECRETS_KEYS"))
+	})
+	return keyring, keyringErr
+}
+
+func parseKeyring(spec string) (*secretKeyring, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, errSecretsDisabled
+	}
+
+	ring := &secretKeyring{keys: map[string]cipher.AEAD{}}
+	for _, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid SECRETS_KEYS entry, expected id:base64key")
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %v", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %q must be 32 bytes, got %d", id, len(key))
+		}
+		if _, ok := ring.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate key id %q in SECRETS_KEYS", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		if ring.primary == "" {
+			ring.primary = id
+		}
+		ring.keys[id] = aead
+	}
+	return ring, nil
+}
+
+// seal encrypts plaintext stored at scope with the primary key.
+func (r *secretKeyring) seal(plaintext []byte, scope secretScope) (string, error) {
+	aead := r.keys[r.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, scope.additionalData(r.primary))
+	return secretFormatVersion + ":" + r.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed for scope with any key of the keyring.
+func (r *secretKeyring) open(value string, scope secretScope) ([]byte, error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 || parts[0] != secretFormatVersion {
+		return nil, errMalformedSecret
+	}
+
+	aead, ok := r.keys[parts[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key %q", parts[1])
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errMalformedSecret
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, scope.additionalData(parts[1]))
+}
+
+// reseal re-encrypts a value stored at scope with the primary key.
+func (r *secretKeyring) reseal(value string, scope secretScope) (string, error) {
+	plaintext, err := r.open(value, scope)
+	if err != nil {
+		return "", err
+	}
+	return r.seal(plaintext, scope)
+}
+
+// encryptSecret encrypts plaintext stored at scope with the primary key.
+func encryptSecret(plaintext []byte, scope secretScope) (string, error) {
+	ring, err := secretsKeyring()
+	if err != nil {
+		return "", err
+	}
+	return ring.seal(plaintext, scope)
+}
+
+// decryptSecret decrypts a value stored at scope. NULL and empty values
+// decrypt to nothing.
+func decryptSecret(stored any, scope secretScope) ([]byte, error) {
+	var value string
+	switch v := stored.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return nil, fmt.Errorf("cannot decrypt %T", stored)
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	ring, err := secretsKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return ring.open(value, scope)
+}
+
+// crawlCredentials are sent with requests to the analyzed site. They are
+// stored encrypted and never returned by the API.
+type crawlCredentials struct {
+	Cookies           string `json:"cookies,omitempty" binding:"max=4096"`
+	BasicAuthUser     string `json:"basic_auth_user,omitempty" binding:"max=255"`
+	BasicAuthPassword string `json:"basic_auth_password,omitempty" binding:"max=255"`
+}
+
+func (c crawlCredentials) empty() bool {
+	return c == crawlCredentials{}
+}
+
+// merge layers override on top of c: every credential set in override wins.
+func (c crawlCredentials) merge(override crawlCredentials) crawlCredentials {
+	if override.Cookies != "" {
+		c.Cookies = override.Cookies
+	}
+	if override.BasicAuthUser != "" {
+		c.BasicAuthUser = override.BasicAuthUser
+		c.BasicAuthPassword = override.BasicAuthPassword
+	}
+	return c
+}
+
+// open decrypts credentials stored at scope. NULL reads as no
+// credentials.
+func (c *crawlCredentials) open(stored any, scope secretScope) error {
+	*c = crawlCredentials{}
+	plaintext, err := decryptSecret(stored, scope)
+	if err != nil || plaintext == nil {
+		return err
+	}
+	return json.Unmarshal(plaintext, c)
+}
+
+// seal encrypts credentials stored at scope with the primary key. Empty
+// credentials are stored as NULL so they work without a configured key.
+func (c crawlCredentials) seal(scope secretScope) (any, error) {
+	if c.empty() {
+		return nil, nil
+	}
+
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return encryptSecret(plaintext, scope)
+}
+
+// storeCredentials encrypts and stores credentials in a row of table.
+// Values are encrypted for their row, so the credentials of a new row are
+// stored once its id is known.
+func storeCredentials(e execer, table string, id int, credentials crawlCredentials) error {
+	sealed, err := credentials.seal(secretScope{table, "credentials", id})
+	if err != nil {
+		return err
+	}
+	_, err = e.Exec("UPDATE "+table+" SET credentials = ? WHERE id = ?", sealed, id)
+	return err
+}
+
+// Encrypted columns, re-encrypted by a key rotation.
+var secretColumns = []struct{ table, column string }{
+	{"projects", "credentials"},
+	{"analyses", "credentials"},
+	{"projects", "webhook_token"},
+}
+
+// rotateSecretsHandler re-encrypts every sensitive column with the current
+// primary key, so older keys can be removed from SECRETS_KEYS afterwards.
+func rotateSecretsHandler(c *gin.Context) {
+	ring, err := secretsKeyring()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	rotated := gin.H{}
+	for _, col := range secretColumns {
+		count, err := rotateSecretColumn(ring, col.table, col.column)
+		if err != nil {
+			log.Printf("Error rotating %s.%s: %v", col.table, col.column, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate secrets", "rotated": rotated})
+			return
+		}
+		rotated[col.table+"."+col.column] = count
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rotated": rotated})
+}
+
+// rotateSecretColumn re-encrypts the values of a column. A value is only
+// replaced while it is still the one read, so a concurrent update is never
+// overwritten; it is encrypted with the primary key already.
+func rotateSecretColumn(ring *secretKeyring, table, column string) (int, error) {
+	rows, err := db.Query("SELECT id, " + column + " FROM " + table + " WHERE " + column + " IS NOT NULL")
+	if err != nil {
+		return 0, err
+	}
+
+	type row struct {
+		id    int
+		value string
+	}
+	var pending []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.value); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, r := range pending {
+		resealed, err := ring.reseal(r.value, secretScope{table, column, r.id})
+		if err != nil {
+			return rotated, fmt.Errorf("row %d: %w", r.id, err)
+		}
+
+		result, err := db.Exec("UPDATE "+table+" SET "+column+" = ? WHERE id = ? AND "+column+" = ?", resealed, r.id, r.value)
+		if err != nil {
+			return rotated, err
+		}
+		if affected, _ := result.RowsAffected(); affected > 0 {
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// mergeStoredCredentials decrypts project and analysis credentials and
+// layers the analysis ones on top.
+func mergeStoredCredentials(projectID int, project sql.NullString, analysisID int, analysis sql.NullString) (crawlCredentials, error) {
+	var base, override crawlCredentials
+	if err := base.open(nullStringValue(project), secretScope{"projects", "credentials", projectID}); err != nil {
+		return crawlCredentials{}, err
+	}
+	if err := override.open(nullStringValue(analysis), secretScope{"analyses", "credentials", analysisID}); err != nil {
+		return crawlCredentials{}, err
+	}
+	return base.merge(override), nil
+}
+
+func nullStringValue(s sql.NullString) any {
+	if !s.Valid {
+		return nil
+	}
+	return s.String
+}
+
+// credentialsStorable answers the request and returns false when
+// credentials were sent but cannot be encrypted.
+func credentialsStorable(c *gin.Context, credentials crawlCredentials) bool {
+	if credentials.empty() {
+		return true
+	}
+	if _, err := secretsKeyring(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
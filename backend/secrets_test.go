@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func testKeyring(t *testing.T, spec string) *secretKeyring {
+	t.Helper()
+	ring, err := parseKeyring(spec)
+	if err != nil {
+		t.Fatalf("parseKeyring: %v", err)
+	}
+	return ring
+}
+
+func TestSecretRoundTrip(t *testing.T) {
+	ring := testKeyring(t, "k1:"+testKey(t))
+	scope := secretScope{"projects", "credentials", 7}
+
+	sealed, err := ring.seal([]byte("s3cret"), scope)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if !strings.HasPrefix(sealed, "v1:k1:") || strings.Contains(sealed, "s3cret") {
+		t.Fatalf("sealed value %q", sealed)
+	}
+
+	plaintext, err := ring.open(sealed, scope)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !bytes.Equal(plaintext, []byte("s3cret")) {
+		t.Errorf("open = %q, want %q", plaintext, "s3cret")
+	}
+}
+
+func TestSecretBoundToScope(t *testing.T) {
+	ring := testKeyring(t, "k1:"+testKey(t))
+	sealed, err := ring.seal([]byte("s3cret"), secretScope{"projects", "credentials", 7})
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	for _, scope := range []secretScope{
+		{"projects", "credentials", 8},
+		{"analyses", "credentials", 7},
+		{"projects", "webhook_token", 7},
+	} {
+		if _, err := ring.open(sealed, scope); err == nil {
+			t.Errorf("value opened at %+v", scope)
+		}
+	}
+}
+
+func TestSecretKeyRotation(t *testing.T) {
+	oldKey, newKey := testKey(t), testKey(t)
+	scope := secretScope{"analyses", "credentials", 3}
+
+	sealed, err := testKeyring(t, "old:"+oldKey).seal([]byte("s3cret"), scope)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	rotating := testKeyring(t, "new:"+newKey+",old:"+oldKey)
+	if _, err := rotating.open(sealed, scope); err != nil {
+		t.Fatalf("open with old key: %v", err)
+	}
+	resealed, err := rotating.reseal(sealed, scope)
+	if err != nil {
+		t.Fatalf("reseal: %v", err)
+	}
+	if !strings.HasPrefix(resealed, "v1:new:") {
+		t.Fatalf("resealed value %q not encrypted with the new key", resealed)
+	}
+
+	rotated := testKeyring(t, "new:"+newKey)
+	plaintext, err := rotated.open(resealed, scope)
+	if err != nil {
+		t.Fatalf("open after rotation: %v", err)
+	}
+	if !bytes.Equal(plaintext, []byte("s3cret")) {
+		t.Errorf("open = %q, want %q", plaintext, "s3cret")
+	}
+	if _, err := rotated.open(sealed, scope); err == nil {
+		t.Error("value of a removed key opened")
+	}
+}
+
+func TestParseKeyringRejectsInvalidKeys(t *testing.T) {
+	if _, err := parseKeyring("k1:" + base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("short key accepted")
+	}
+	if _, err := parseKeyring("k1:" + testKey(t) + ",k1:" + testKey(t)); err == nil {
+		t.Error("duplicate key id accepted")
+	}
+	if _, err := parseKeyring(""); err != errSecretsDisabled {
+		t.Errorf("empty spec: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// loadValues reads a text column of a table holding rows related to an
+// analysis, in insertion order. table and column are never user input.
+func loadValues(table, column string, analysisID int) ([]string, error) {
+	rows, err := db.Query("SELECT "+column+" FROM "+table+" WHERE analysis_id = ? ORDER BY id", analysisID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// maxIDsPerQuery bounds the IN lists of queries reading rows of several
+// analyses at once.
+const maxIDsPerQuery = 500
+
+// queryAnalysesRows runs query for the rows related to analysisIDs and
+// calls scan on each of them. The "IN (?)" of query is expanded to one
+// placeholder per ID, followed by args; long ID lists are queried in
+// batches.
+func queryAnalysesRows(query string, analysisIDs []int, scan func(*sql.Rows) error, args ...any) error {
+	for start := 0; start < len(analysisIDs); start += maxIDsPerQuery {
+		batch := analysisIDs[start:min(start+maxIDsPerQuery, len(analysisIDs))]
+		batchArgs := make([]any, 0, len(batch)+len(args))
+		for _, id := range batch {
+			batchArgs = append(batchArgs, id)
+		}
+		batchArgs = append(batchArgs, args...)
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		rows, err := db.Query(strings.Replace(query, "IN (?)", "IN ("+placeholders+")", 1), batchArgs...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadValuesOf is loadValues for several analyses at once, keyed by
+// analysis ID.
+func loadValuesOf(table, column string, analysisIDs []int) (map[int][]string, error) {
+	values := map[int][]string{}
+	err := queryAnalysesRows("SELECT analysis_id, "+column+" FROM "+table+" WHERE analysis_id IN (?) ORDER BY id", analysisIDs, func(rows *sql.Rows) error {
+		var analysisID int
+		var value string
+		if err := rows.Scan(&analysisID, &value); err != nil {
+			return err
+		}
+		values[analysisID] = append(values[analysisID], value)
+		return nil
+	})
+	return values, err
+}
+
+// replaceValues replaces the rows related to an analysis in table with one
+// row per value.
+func replaceValues(tx *sql.Tx, table, column string, analysisID int, values []string) error {
+	if _, err := tx.Exec("DELETE FROM "+table+" WHERE analysis_id = ?", analysisID); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if _, err := tx.Exec("INSERT INTO "+table+" (analysis_id, "+column+") VALUES (?, ?)", analysisID, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceLinks stores the links found on the page of an analysis together
+// with their anchor texts.
+func replaceLinks(tx *sql.Tx, analysisID int, links []string, anchorTexts map[string]string) error {
+	if _, err := tx.Exec("DELETE FROM links WHERE analysis_id = ?", analysisID); err != nil {
+		return err
+	}
+	for _, link := range links {
+		if _, err := tx.Exec("INSERT INTO links (analysis_id, link, anchor_text) VALUES (?, ?, ?)", analysisID, link, anchorTexts[link]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadAnchorTexts returns the anchor text of each link of an analysis.
+func loadAnchorTexts(analysisID int) (map[string]string, error) {
+	rows, err := db.Query("SELECT link, COALESCE(anchor_text, '') FROM links WHERE analysis_id = ? ORDER BY id", analysisID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	anchorTexts := map[string]string{}
+	for rows.Next() {
+		var link, text string
+		if err := rows.Scan(&link, &text); err != nil {
+			return nil, err
+		}
+		if _, ok := anchorTexts[link]; !ok {
+			anchorTexts[link] = text
+		}
+	}
+	return anchorTexts, rows.Err()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// setAnalysisStatus updates the status of an analysis together with its
+// timestamps: updated_at always moves, finished_at is set when the status is
+// final and cleared when the analysis is queued or running again.
+func setAnalysisStatus(e execer, analysisID int, status string) error {
+	finishedAt := "NULL"
+	if finalStatus(status) {
+		finishedAt = "CURRENT_TIMESTAMP"
+	}
+
+	_, err := e.Exec("UPDATE analyses SET status = ?, updated_at = CURRENT_TIMESTAMP, finished_at = "+finishedAt+" WHERE id = ?", status, analysisID)
+	return err
+}
+
+func finalStatus(status string) bool {
+	return status == "done" || status == "error" || status == "stopped"
+}
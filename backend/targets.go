@@ -0,0 +1,237 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"challenge-sykell/backend/analyzer"
+)
+
+// Target rules gate which URLs may be analyzed. A URL matching a deny rule
+// is always rejected; once any allow rule exists, only URLs matching one of
+// them are accepted. Host rules match the host and its subdomains, pattern
+// rules are regular expressions matched against the whole URL. Rules are
+// checked when a URL is submitted and again for every request of a crawl.
+//
+// Host names can resolve to any address, so CIDR rules are checked against
+// the address every connection of a crawl is made to: denied ranges are
+// never dialed and once any CIDR allow rule exists, only addresses in one
+// of the allowed ranges are. URLs with an IP address as host are checked
+// against them on submission already.
+
+type targetRule struct {
+	ID        int       `json:"id"`
+	Action    string    `json:"action"`
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+
+	pattern *regexp.Regexp
+	prefix  netip.Prefix
+}
+
+func (r targetRule) matches(u *url.URL) bool {
+	switch r.Kind {
+	case "pattern":
+		return r.pattern != nil && r.pattern.MatchString(u.String())
+	case "cidr":
+		addr, err := netip.ParseAddr(u.Hostname())
+		return err == nil && r.containsAddr(addr)
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == r.Value || strings.HasSuffix(host, "."+r.Value)
+}
+
+func (r targetRule) containsAddr(addr netip.Addr) bool {
+	return r.prefix.IsValid() && r.prefix.Contains(addr.Unmap())
+}
+
+// ipHost reports whether the host of u is an IP address.
+func ipHost(u *url.URL) bool {
+	_, err := netip.ParseAddr(u.Hostname())
+	return err == nil
+}
+
+// targetPolicy is the set of rules in effect for a crawl.
+type targetPolicy struct {
+	allow []targetRule
+	deny  []targetRule
+}
+
+func (p targetPolicy) allows(u *url.URL) bool {
+	for _, rule := range p.deny {
+		if rule.matches(u) {
+			return false
+		}
+	}
+	restricted := false
+	for _, rule := range p.allow {
+		// The addresses host names resolve to are checked when dialing.
+		if rule.Kind == "cidr" && !ipHost(u) {
+			continue
+		}
+		if rule.matches(u) {
+			return true
+		}
+		restricted = true
+	}
+	return !restricted
+}
+
+// allowsAddr reports whether connections to addr may be made.
+func (p targetPolicy) allowsAddr(addr netip.Addr) bool {
+	for _, rule := range p.deny {
+		if rule.Kind == "cidr" && rule.containsAddr(addr) {
+			return false
+		}
+	}
+	restricted := false
+	for _, rule := range p.allow {
+		if rule.Kind != "cidr" {
+			continue
+		}
+		if rule.containsAddr(addr) {
+			return true
+		}
+		restricted = true
+	}
+	return !restricted
+}
+
+func loadTargetRules() ([]targetRule, error) {
+	rows, err := db.Query("SELECT id, action, kind, value, COALESCE(note, ''), created_at FROM target_rules ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []targetRule{}
+	for rows.Next() {
+		var r targetRule
+		if err := rows.Scan(&r.ID, &r.Action, &r.Kind, &r.Value, &r.Note, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		// Patterns and prefixes are validated before they are stored.
+		switch r.Kind {
+		case "pattern":
+			r.pattern, _ = regexp.Compile(r.Value)
+		case "cidr":
+			r.prefix, _ = netip.ParsePrefix(r.Value)
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func loadTargetPolicy() (targetPolicy, error) {
+	rules, err := loadTargetRules()
+	if err != nil {
+		return targetPolicy{}, err
+	}
+
+	var policy targetPolicy
+	for _, rule := range rules {
+		if rule.Action == "allow" {
+			policy.allow = append(policy.allow, rule)
+		} else {
+			policy.deny = append(policy.deny, rule)
+		}
+	}
+	return policy, nil
+}
+
+// targetAllowed answers the request and returns false when rawURL may not
+// be analyzed.
+func targetAllowed(c *gin.Context, rawURL string) bool {
+	policy, err := loadTargetPolicy()
+	if err != nil {
+		log.Printf("Error querying target rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query target rules"})
+		return false
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || !policy.allows(u) {
+		c.JSON(http.StatusForbidden, gin.H{"error": analyzer.ErrTargetBlocked.Error()})
+		return false
+	}
+	return true
+}
+
+func getTargetRulesHandler(c *gin.Context) {
+	rules, err := loadTargetRules()
+	if err != nil {
+		log.Printf("Error querying target rules: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query target rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+func createTargetRuleHandler(c *gin.Context) {
+	var body struct {
+		Action string `json:"action" binding:"required,oneof=allow deny"`
+		Kind   string `json:"kind" binding:"required,oneof=host pattern cidr"`
+		Value  string `json:"value" binding:"required,max=2048"`
+		Note   string `json:"note" binding:"max=1000"`
+	}
+	if !bindBody(c, &body) {
+		return
+	}
+
+	switch body.Kind {
+	case "host":
+		body.Value = strings.ToLower(strings.TrimSpace(body.Value))
+	case "pattern":
+		if _, err := regexp.Compile(body.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": gin.H{"value": "must be a valid regular expression"}})
+			return
+		}
+	case "cidr":
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(body.Value))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body", "fields": gin.H{"value": "must be a CIDR range such as 10.0.0.0/8"}})
+			return
+		}
+		body.Value = prefix.Masked().String()
+	}
+
+	result, err := db.Exec("INSERT INTO target_rules (action, kind, value, note) VALUES (?, ?, ?, ?)", body.Action, body.Kind, body.Value, body.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	var rule targetRule
+	err = db.QueryRow("SELECT id, action, kind, value, COALESCE(note, ''), created_at FROM target_rules WHERE id = ?", id).Scan(&rule.ID, &rule.Action, &rule.Kind, &rule.Value, &rule.Note, &rule.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func deleteTargetRuleHandler(c *gin.Context) {
+	result, err := db.Exec("DELETE FROM target_rules WHERE id = ?", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target rule not found"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A project can get a webhook token so CI/CD systems can re-analyze its
+// URLs after a deploy. The token is only shown when it is issued and is
+// stored encrypted like crawl credentials. Jobs started by the webhook
+// count towards the project's quotas and are owned by the token.
+
+// webhookScope is where the webhook token of a project is stored.
+func webhookScope(projectID int) secretScope {
+	return secretScope{"projects", "webhook_token", projectID}
+}
+
+func webhookLocation(projectID int) string {
+	return fmt.Sprintf("/api/hooks/projects/%d/reanalyze", projectID)
+}
+
+// createWebhookHandler issues a new webhook token for a project, replacing
+// the previous one.
+func createWebhookHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+	if _, err := secretsKeyring(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	sealed, err := encryptSecret([]byte(token), webhookScope(project.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err = db.Exec("UPDATE projects SET webhook_token = ? WHERE id = ?", sealed, project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"project_id": project.ID,
+		"token":      token,
+		"url":        webhookLocation(project.ID),
+	})
+}
+
+func deleteWebhookHandler(c *gin.Context) {
+	project, ok := projectFromParam(c)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec("UPDATE projects SET webhook_token = NULL WHERE id = ?", project.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// webhookAuthorized reports whether token is the webhook token of the
+// project. Unknown projects and projects without a webhook never match.
+func webhookAuthorized(projectID int, token string) (bool, error) {
+	var stored sql.NullString
+	err := db.QueryRow("SELECT webhook_token FROM projects WHERE id = ?", projectID).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	webhookToken, err := decryptSecret(nullStringValue(stored), webhookScope(projectID))
+	if err != nil || len(webhookToken) == 0 {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(webhookToken, []byte(token)) == 1, nil
+}
+
+// triggeredJob is a job queued by the webhook.
+type triggeredJob struct {
+	JobID      int    `json:"job_id"`
+	AnalysisID int    `json:"analysis_id"`
+	URL        string `json:"url"`
+	Self       string `json:"self"`
+}
+
+// reanalyzeProjectHandler queues a full run of the latest analysis of every
+// URL of a project. Analyses with a queued or running job are skipped. The
+// batch is queued as a whole or not at all.
+func reanalyzeProjectHandler(c *gin.Context) {
+	projectID, err := strconv.Atoi(c.Param("id"))
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if err != nil || !found || token == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Webhook token required"})
+		return
+	}
+
+	authorized, err := webhookAuthorized(projectID, token)
+	if err != nil {
+		log.Printf("Error checking webhook token of project %d: %v", projectID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check webhook token"})
+		return
+	}
+	if !authorized {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook token"})
+		return
+	}
+
+	if rejectWhileDraining(c) {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	jobs, skipped, err := enqueueProject(tx, projectID, userID(token))
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		tx.Rollback()
+		respondQuotaExceeded(c, quotaErr)
+		return
+	}
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"project_id": projectID,
+		"jobs":       jobs,
+		"skipped":    skipped,
+	})
+}
+
+// enqueueProject queues a full run of the latest analysis of every URL of
+// a project and returns the queued jobs and the IDs of the analyses skipped
+// because they have a queued or running job.
+func enqueueProject(tx *sql.Tx, projectID int, owner string) ([]triggeredJob, []int, error) {
+	rows, err := tx.Query("SELECT id, url FROM analyses WHERE id IN (SELECT MAX(id) FROM analyses WHERE project_id = ? GROUP BY url) ORDER BY id", projectID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	type target struct {
+		id  int
+		url string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.id, &t.url); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	jobs, skipped := []triggeredJob{}, []int{}
+	for _, t := range targets {
+		jobID, err := enqueueJob(tx, t.id, jobKindFull, 0, owner)
+		if err == errJobActive {
+			skipped = append(skipped, t.id)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, triggeredJob{JobID: jobID, AnalysisID: t.id, URL: t.url, Self: jobLocation(jobID)})
+	}
+	return jobs, skipped, nil
+}
@@ -26,7 +26,7 @@ interface AnalysisResult {
   status: "queued" | "running" | "done" | "error" | "stopped";
   internal_links: number;
   external_links: number;
-  inaccessible_links: number;
+  inaccessible_links: number | null;
   has_login_form: boolean;
   h1_count: number;
   h2_count: number;
@@ -88,6 +88,7 @@ export const columns: ColumnDef<AnalysisResult>[] = [
   {
     accessorKey: "inaccessible_links",
     header: "Broken Links",
+    cell: ({ row }) => row.getValue<number | null>("inaccessible_links") ?? "Not checked",
   },
   {
     accessorKey: "has_login_form",
@@ -13,7 +13,7 @@ interface AnalysisResult {
   status: "queued" | "running" | "done" | "error" | "stopped";
   internal_links: number;
   external_links: number;
-  inaccessible_links: number;
+  inaccessible_links: number | null;
   has_login_form: boolean;
   broken_links?: string[];
   h1_count: number;